@@ -3,12 +3,12 @@ package cli
 import (
 	"errors"
 	"fmt"
-	"strings"
+	"os"
 	"time"
 
 	"github.com/briandowns/spinner"
+	"github.com/mrtnhwtt/kittypass/internal/crypto"
 	"github.com/mrtnhwtt/kittypass/internal/kittypass"
-	"github.com/mrtnhwtt/kittypass/internal/prompt"
 	"github.com/spf13/cobra"
 )
 
@@ -32,26 +32,57 @@ func NewAddCmd() *cobra.Command {
 
 func NewAddVaultCmd() *cobra.Command {
 	vault := kittypass.NewVault()
+	var kdf kdfFlags
+	var force bool
 	cmd := &cobra.Command{
 		Use:     "vault",
 		Aliases: []string{"folder"},
 		Short:   "Create a new Vault.",
 		Long:    "Create a new Vault to store login infornmation. Requires a master password.",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			_, err := crypto.New(vault.Cipher)
+			if err != nil {
+				return err
+			}
+			vault.KDF, err = kdf.params(cmd, crypto.DefaultKDFParams)
+			if err != nil {
+				return err
+			}
+			return vault.KDF.Validate()
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			vault.Masterpass = strings.TrimSpace(prompt.PasswordPrompt("Input master password:"))
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			vault.Storage = db
+
+			vault.Masterpass, err = masterSecret.read("Input master password:")
+			if err != nil {
+				return err
+			}
 			if vault.Masterpass == "" {
 				return errors.New("invalid empty master password")
 			}
-			confirm := strings.TrimSpace(prompt.PasswordPrompt("Confirm master password:"))
-			if vault.Masterpass != confirm {
-				return errors.New("master password does not match")
+			if err := checkStrength(vault.Masterpass, force, vault.Name, vault.Description); err != nil {
+				return err
+			}
+			if masterSecret.prompted() {
+				confirm, err := masterSecret.read("Confirm master password:")
+				if err != nil {
+					return err
+				}
+				if vault.Masterpass != confirm {
+					return errors.New("master password does not match")
+				}
 			}
 			s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
 			s.Color("green")
 			s.Prefix = "Creating Vault"
 			s.Start()
 
-			err := vault.CreateVault()
+			err = vault.CreateVault()
 			if err != nil {
 				s.FinalMSG = red("Vault creation failed.\n")
 				s.Stop()
@@ -65,6 +96,9 @@ func NewAddVaultCmd() *cobra.Command {
 
 	cmd.Flags().StringVarP(&vault.Name, "name", "n", "", "Name of the Vault")
 	cmd.Flags().StringVarP(&vault.Description, "description", "d", "", "Description of the Vault")
+	kdf.register(cmd)
+	cmd.Flags().BoolVar(&force, "force", false, "Accept a master password below the minimum strength score")
+	cmd.Flags().StringVar(&vault.Cipher, "cipher", crypto.AES, fmt.Sprintf("Encryption algorithm of the Vault, one of %s or %s", crypto.AES, crypto.XChaCha20Poly1305))
 	cmd.MarkFlagRequired("name")
 
 	return cmd
@@ -74,60 +108,87 @@ func NewAddLoginCmd() *cobra.Command {
 	login := kittypass.NewLogin()
 	vault := kittypass.NewVault()
 	login.Vault = &vault
+	var policyName, hibpFile string
+	var force bool
+	var loginSecret *secretSource
 	cmd := &cobra.Command{
 		Use:     "login",
 		Aliases: []string{"pass", "password"},
 		Short:   "Create a new Login",
 		Long:    "Create a new Login storing a username and password pair. If no password are provided, generates a new password for the login.",
 		PreRunE: func(cmd *cobra.Command, args []string) error {
-			if login.Generator.Length < 5 || login.Generator.Length > 64 {
-				return fmt.Errorf("invalid password length %d, please set a password length between 5 and 64", login.Generator.Length)
+			// reading the password from standard input or a file implies --password
+			login.ProvidePassword = login.ProvidePassword || !loginSecret.prompted()
+			if login.ProvidePassword {
+				if login.Generator.Passphrase {
+					return errors.New("a provided password cannot be combined with --passphrase")
+				}
+				loginSecret.useDefaultFile(conf.LoginPasswordFile)
 			}
-			return nil
+			if policyName != "" {
+				if generatorFlagsChanged(cmd) {
+					return errors.New("password generator options cannot be combined with --policy")
+				}
+				return nil
+			}
+			if login.ProvidePassword {
+				return nil
+			}
+			return login.Generator.Validate()
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			err := login.Vault.Get()
+			db, err := openStorage()
 			if err != nil {
 				return err
 			}
+			defer db.Close()
+			login.Vault.Storage = db
 
-			s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
-			s.Color("green")
-			s.Prefix = "Checking Master Password"
-
-			login.Vault.Masterpass = strings.TrimSpace(prompt.PasswordPrompt("Input master password:"))
-			if login.Vault.Masterpass == "" {
-				return errors.New("invalid empty master password")
-			}
-
-			s.Start()
-
-			if err := login.Vault.MasterpassMatch(); err != nil {
-				s.FinalMSG = red("Master Password check failed.\n")
-				s.Stop()
-				return err
+			if policyName != "" {
+				if err := login.UsePolicy(policyName); err != nil {
+					return err
+				}
 			}
-			err = login.Vault.RecreateDerivationKey()
+			err = unlockVault(login.Vault)
 			if err != nil {
-				s.FinalMSG = red("Opening Vault failed.\n")
-				s.Stop()
 				return err
 			}
-			s.FinalMSG = green("✓ Successfully opened Vault.\n")
-			s.Stop()
 
 			if login.ProvidePassword {
-				login.Password = strings.TrimSpace(prompt.PasswordPrompt("Input password:"))
+				login.Password, err = loginSecret.read("Input password:")
+				if err != nil {
+					return err
+				}
 				if login.Password == "" {
 					return errors.New("invalide empty password")
 				}
-				confirm := strings.TrimSpace(prompt.PasswordPrompt("Confirm password:"))
-				if login.Password != confirm {
-					return errors.New("password does not match")
+				if err := checkStrength(login.Password, force, login.Name, login.Username, login.Vault.Name); err != nil {
+					return err
+				}
+				if hibpFile == "" {
+					hibpFile = conf.HIBPFile
+				}
+				if err := checkBreached(login.Password, hibpFile, force); err != nil {
+					return err
+				}
+				if loginSecret.prompted() {
+					confirm, err := loginSecret.read("Confirm password:")
+					if err != nil {
+						return err
+					}
+					if login.Password != confirm {
+						return errors.New("password does not match")
+					}
 				}
 			} else {
-				login.Password = login.Generator.GeneratePassword()
+				login.Password, err = login.Generator.GeneratePassword()
+				if err != nil {
+					return err
+				}
+				printEntropy(os.Stdout, &login.Generator)
 			}
+			s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
+			s.Color("green")
 			s.Prefix = "Adding login to Vault"
 			s.Start()
 			err = login.Add()
@@ -145,10 +206,12 @@ func NewAddLoginCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&login.Username, "username", "u", "", "Username or email for the login")
 	cmd.Flags().StringVarP(&login.Vault.Name, "vault-name", "v", "", "Name of the Vault")
 	cmd.Flags().BoolVarP(&login.ProvidePassword, "password", "p", false, "Use to set the password instead of generating a new password")
-	cmd.Flags().IntVarP(&login.Generator.Length, "lenght", "l", 16, "Length of the generated password")
-	cmd.Flags().BoolVarP(&login.Generator.SpecialChar, "special-char", "s", false, "Use special character in the password")
-	cmd.Flags().BoolVarP(&login.Generator.Numeral, "numeral", "N", false, "Add number in the password")
-	cmd.Flags().BoolVarP(&login.Generator.Uppercase, "uppercase", "U", false, "Use uppercase and lowercase characters")
+	loginSecret = newLoginSecret(cmd)
+	cmd.Flags().BoolVar(&force, "force", false, "Accept a password below the minimum strength score or seen in breaches")
+	cmd.Flags().StringVar(&hibpFile, "hibp-file", "", "Have I Been Pwned SHA-1 password list ordered by hash to check the provided password against, defaults to the hibp_file setting")
+	registerGeneratorFlags(cmd, &login.Generator)
+	cmd.Flags().StringVar(&policyName, "policy", "", "Name of the password policy generating the passwords of the login")
+	cmd.MarkFlagsMutuallyExclusive("password", "passphrase")
 	cmd.MarkFlagRequired("name")
 	cmd.MarkFlagRequired("username")
 	cmd.MarkFlagRequired("vault-name")
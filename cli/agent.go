@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mrtnhwtt/kittypass/internal/agent"
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+	"github.com/spf13/cobra"
+)
+
+// agentStartTimeout bounds how long starting the agent in the background waits for its socket.
+const agentStartTimeout = 5 * time.Second
+
+func NewAgentCmd() *cobra.Command {
+	var foreground bool
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Start the agent holding the keys of unlocked Vaults.",
+		Long: "Start the agent in the background. Vaults unlocked with kittypass unlock are opened by the agent without asking for their master password, " +
+			"until they are locked with kittypass lock or their key is not used for the idle timeout. The agent listens on a Unix socket only your user can use.",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("timeout") {
+				timeout = conf.AgentTimeout
+			}
+			if timeout < 0 {
+				return fmt.Errorf("invalid timeout %s, please set a duration of 0 or more", timeout)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if foreground {
+				return runAgent(timeout)
+			}
+
+			client := agent.NewClient(conf.AgentSocket)
+			if err := client.Ping(); err == nil {
+				return agent.AlreadyRunningError{Path: conf.AgentSocket}
+			}
+			if err := startDetached(nil, "agent", "--foreground", "--timeout", timeout.String()); err != nil {
+				return err
+			}
+			deadline := time.Now().Add(agentStartTimeout)
+			for client.Ping() != nil {
+				if time.Now().After(deadline) {
+					return fmt.Errorf("agent did not start listening on %s, see the log file %s", conf.AgentSocket, conf.LogFile)
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+			fmt.Printf("%s %s\n", green("✓ Agent started, listening on"), blue(conf.AgentSocket))
+			if timeout > 0 {
+				fmt.Printf("%s %s %s\n", green("Keys of unlocked Vaults are forgotten after"), blue(timeout), green("without use."))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&foreground, "foreground", false, "Run the agent in the foreground until interrupted")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "Forget the key of a Vault not used for this long, 0 to keep keys until locked. Defaults to the agent_timeout setting")
+	cmd.AddCommand(NewAgentStopCmd())
+	return cmd
+}
+
+// runAgent serves the agent until it is stopped or interrupted.
+func runAgent(timeout time.Duration) error {
+	server, err := agent.Listen(conf.AgentSocket, timeout)
+	if err != nil {
+		return err
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-signals
+		log.Printf("agent stopping on signal %s", sig)
+		server.Stop()
+	}()
+	log.Printf("agent listening on %s, idle timeout %s", conf.AgentSocket, timeout)
+	err = server.Serve()
+	log.Printf("agent stopped")
+	return err
+}
+
+func NewAgentStopCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the agent.",
+		Long:  "Stop the agent, which forgets the keys of every unlocked Vault.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := agent.NewClient(conf.AgentSocket).Stop(); err != nil {
+				return err
+			}
+			fmt.Println(green("✓ Agent stopped."))
+			return nil
+		},
+	}
+	return cmd
+}
+
+func NewUnlockCmd() *cobra.Command {
+	vault := kittypass.NewVault()
+
+	cmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "Unlock a Vault in the agent.",
+		Long:  "Check the master password of a Vault and hand its key over to the agent, so that the next commands open the Vault without asking for the master password.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := agent.NewClient(conf.AgentSocket)
+			if err := client.Ping(); err != nil {
+				return err
+			}
+
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			vault.Storage = db
+
+			err = unlockVaultWithPassword(&vault)
+			if err != nil {
+				return err
+			}
+			if err := client.Add(vault.Uuid, vault.DerivationKey); err != nil {
+				return err
+			}
+			fmt.Printf("%s %s %s\n", green("✓ Vault"), blue(vault.Name), green("unlocked in the agent."))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&vault.Name, "vault", "v", "", "vault's name")
+	cmd.MarkFlagRequired("vault")
+	return cmd
+}
+
+func NewLockCmd() *cobra.Command {
+	vault := kittypass.NewVault()
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Lock Vaults unlocked in the agent.",
+		Long:  "Make the agent forget the key of a Vault, or of every Vault with --all. The master password is asked for again the next time the Vault is opened.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := agent.NewClient(conf.AgentSocket)
+			if all {
+				locked, err := client.Lock("")
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s%s%s\n", green("✓ Locked "), blue(locked), green(" Vaults."))
+				return nil
+			}
+
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			vault.Storage = db
+			if err := vault.Get(); err != nil {
+				return err
+			}
+			locked, err := client.Lock(vault.Uuid)
+			if err != nil {
+				return err
+			}
+			if locked == 0 {
+				return errors.New("vault is not unlocked in the agent")
+			}
+			fmt.Printf("%s %s %s\n", green("✓ Vault"), blue(vault.Name), green("locked."))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&vault.Name, "vault", "v", "", "vault's name")
+	cmd.Flags().BoolVar(&all, "all", false, "Lock every Vault unlocked in the agent")
+	cmd.MarkFlagsOneRequired("vault", "all")
+	cmd.MarkFlagsMutuallyExclusive("vault", "all")
+	return cmd
+}
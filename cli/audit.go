@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/mrtnhwtt/kittypass/internal/hibp"
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+	"github.com/mrtnhwtt/kittypass/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+func NewAuditCmd() *cobra.Command {
+	var vaultNames []string
+	var maxAgeDays int
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Audit the passwords of vaults.",
+		Long:  "Unlock one or more vaults and report reused, weak and old passwords, and usernames and passwords shared across the vaults.",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if maxAgeDays < 0 {
+				return fmt.Errorf("invalid maximum age %d, please set a number of days of 0 or more", maxAgeDays)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			vaults, err := unlockVaults(db, vaultNames)
+			if err != nil {
+				return err
+			}
+
+			maxAge := time.Duration(maxAgeDays) * 24 * time.Hour
+			report, err := kittypass.Audit(vaults, conf.MinPasswordScore, maxAge, time.Now())
+			if err != nil {
+				return err
+			}
+			printAuditReport(report, maxAgeDays)
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVarP(&vaultNames, "vault", "v", nil, "Name of a vault to audit, repeat to audit several vaults together")
+	cmd.Flags().IntVar(&maxAgeDays, "max-age", 365, "Report passwords not changed for more than this number of days, 0 to skip")
+	cmd.MarkFlagRequired("vault")
+	cmd.AddCommand(NewAuditBreachCmd())
+	return cmd
+}
+
+func NewAuditBreachCmd() *cobra.Command {
+	var vaultNames []string
+	var hibpFile string
+
+	cmd := &cobra.Command{
+		Use:   "breach",
+		Short: "Check the passwords of vaults against breached passwords.",
+		Long:  "Unlock one or more vaults and look every password up in a local copy of the Have I Been Pwned password list ordered by hash. The list is searched on disk and never loaded in memory.",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if hibpFile == "" {
+				hibpFile = conf.HIBPFile
+			}
+			if hibpFile == "" {
+				return errors.New("no password list to check against, please set --hibp-file or the hibp_file setting")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			list, err := hibp.Open(hibpFile)
+			if err != nil {
+				return err
+			}
+			defer list.Close()
+
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			vaults, err := unlockVaults(db, vaultNames)
+			if err != nil {
+				return err
+			}
+
+			s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
+			s.Color("green")
+			s.Prefix = "Checking passwords against breached passwords"
+			s.Start()
+			breached, err := kittypass.AuditBreaches(vaults, list)
+			if err != nil {
+				s.FinalMSG = red("Checking passwords failed.\n")
+				s.Stop()
+				return err
+			}
+			s.Stop()
+
+			fmt.Println("------------------------------------------------------------------------------")
+			if len(breached) == 0 {
+				fmt.Println(green("✓ No breached passwords"))
+			} else {
+				fmt.Printf("%s\n", red(fmt.Sprintf("✗ %d passwords were seen in data breaches:", len(breached))))
+				for _, login := range breached {
+					fmt.Printf("  - %s/%s (%s): seen %d times\n", login.Vault, login.Name, login.Username, login.Occurrences)
+				}
+			}
+			fmt.Println("------------------------------------------------------------------------------")
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVarP(&vaultNames, "vault", "v", nil, "Name of a vault to check, repeat to check several vaults")
+	cmd.Flags().StringVar(&hibpFile, "hibp-file", "", "Have I Been Pwned SHA-1 password list ordered by hash, defaults to the hibp_file setting")
+	cmd.MarkFlagRequired("vault")
+	return cmd
+}
+
+// unlockVaults prompts for the master password of each named vault and unlocks it.
+func unlockVaults(db storage.Backend, names []string) ([]*kittypass.Vault, error) {
+	var vaults []*kittypass.Vault
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		vault := kittypass.NewVault()
+		vault.Name = name
+		vault.Storage = db
+		fmt.Printf("%s %s\n", blue("Unlocking Vault"), name)
+		if err := unlockVault(&vault); err != nil {
+			return nil, err
+		}
+		vaults = append(vaults, &vault)
+	}
+	return vaults, nil
+}
+
+func printAuditReport(report kittypass.AuditReport, maxAgeDays int) {
+	fmt.Printf("\n%s%s%s\n", green("Audited "), blue(report.Logins), green(" Logins."))
+
+	fmt.Println("------------------------------------------------------------------------------")
+	if len(report.Reused) == 0 {
+		fmt.Println(green("✓ No reused passwords"))
+	} else {
+		fmt.Printf("%s\n", red(fmt.Sprintf("✗ %d passwords are reused:", len(report.Reused))))
+		for _, group := range report.Reused {
+			fmt.Println("  Same password for:")
+			for _, login := range group {
+				fmt.Printf("    - %s\n", describeAuditedLogin(login))
+			}
+		}
+	}
+
+	fmt.Println("------------------------------------------------------------------------------")
+	if len(report.Weak) == 0 {
+		fmt.Println(green("✓ No weak passwords"))
+	} else {
+		fmt.Printf("%s\n", red(fmt.Sprintf("✗ %d passwords are weak:", len(report.Weak))))
+		for _, login := range report.Weak {
+			fmt.Printf("  - %s: %d/4 (%s), cracked in %s\n", describeAuditedLogin(login), login.Strength.Score, login.Strength.Label(), login.Strength.CrackTime())
+			if login.Strength.Warning != "" {
+				fmt.Printf("    %s\n", magenta(login.Strength.Warning))
+			}
+		}
+	}
+
+	if maxAgeDays > 0 {
+		fmt.Println("------------------------------------------------------------------------------")
+		if len(report.Old) == 0 {
+			fmt.Println(green(fmt.Sprintf("✓ No passwords older than %d days", maxAgeDays)))
+		} else {
+			fmt.Printf("%s\n", red(fmt.Sprintf("✗ %d passwords are older than %d days:", len(report.Old), maxAgeDays)))
+			for _, login := range report.Old {
+				fmt.Printf("  - %s: last changed %s\n", describeAuditedLogin(login), login.PasswordChanged.Local().Format("02 Jan 2006 15:04"))
+			}
+		}
+	}
+
+	fmt.Println("------------------------------------------------------------------------------")
+	if len(report.SharedCredentials) == 0 {
+		fmt.Println(green("✓ No username and password shared across vaults"))
+	} else {
+		fmt.Printf("%s\n", red(fmt.Sprintf("✗ %d usernames and passwords are shared across vaults:", len(report.SharedCredentials))))
+		for _, group := range report.SharedCredentials {
+			fmt.Printf("  Same username %s and password for:\n", group[0].Username)
+			for _, login := range group {
+				fmt.Printf("    - %s\n", describeAuditedLogin(login))
+			}
+		}
+	}
+	fmt.Println("------------------------------------------------------------------------------")
+}
+
+func describeAuditedLogin(login kittypass.AuditedLogin) string {
+	return fmt.Sprintf("%s/%s (%s)", login.Vault, login.Name, login.Username)
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mrtnhwtt/kittypass/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// scheduleClipboardClear starts a helper in the background that clears the clipboard after a while, if it still holds value.
+// The helper only receives the SHA-256 digest of value, through its standard input.
+func scheduleClipboardClear(value string, after time.Duration) error {
+	digest := sha256.Sum256([]byte(value))
+	return startDetached(digest[:], "clear-clipboard", "--after", after.String())
+}
+
+// NewClearClipboardCmd is the helper started by scheduleClipboardClear. It is not meant to be run by hand.
+func NewClearClipboardCmd() *cobra.Command {
+	var after time.Duration
+
+	cmd := &cobra.Command{
+		Use:    "clear-clipboard",
+		Short:  "Clear the clipboard if it still holds a copied password.",
+		Long:   "Wait, then clear the clipboard if it still holds the value whose SHA-256 digest is read from the standard input.",
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			digest := make([]byte, sha256.Size)
+			if _, err := io.ReadFull(os.Stdin, digest); err != nil {
+				log.Printf("failed to read the digest of the copied password: %s", err)
+				return err
+			}
+			time.Sleep(after)
+
+			content, err := utils.ReadClipboard()
+			if err != nil {
+				log.Printf("failed to read the clipboard before clearing it: %s", err)
+				return err
+			}
+			current := sha256.Sum256([]byte(content))
+			if subtle.ConstantTimeCompare(current[:], digest) != 1 {
+				log.Printf("clipboard no longer holds the copied password, leaving it")
+				return nil
+			}
+			if err := utils.ClearClipboard(); err != nil {
+				log.Printf("failed to clear the clipboard: %s", err)
+				return err
+			}
+			log.Printf("cleared the copied password from the clipboard after %s", after)
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&after, "after", 30*time.Second, "Time to wait before clearing the clipboard")
+	return cmd
+}
@@ -3,12 +3,10 @@ package cli
 import (
 	"errors"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/briandowns/spinner"
 	"github.com/mrtnhwtt/kittypass/internal/kittypass"
-	"github.com/mrtnhwtt/kittypass/internal/prompt"
 	"github.com/spf13/cobra"
 )
 
@@ -40,29 +38,17 @@ func NewDeleteLoginCmd() *cobra.Command {
 		Short:   "delete a saved login",
 		Long:    "delete a saved logins from a vault using the login and vault name",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
-			s.Color("green")
-			s.Prefix = "Checking Master Password"
-
-			login.Vault.Masterpass = strings.TrimSpace(prompt.PasswordPrompt("Input master password:"))
-			if login.Vault.Masterpass == "" {
-				return errors.New("invalid empty master password")
-			}
-
-			s.Start()
-			err := login.Vault.Get()
+			db, err := openStorage()
 			if err != nil {
-				s.FinalMSG = red("Master Password check failed.\n")
-				s.Stop()
 				return err
 			}
-			if err := login.Vault.MasterpassMatch(); err != nil {
-				s.FinalMSG = red("Master Password check failed.\n")
-				s.Stop()
+			defer db.Close()
+			login.Vault.Storage = db
+
+			err = unlockVault(login.Vault)
+			if err != nil {
 				return err
 			}
-			s.FinalMSG = green("✓ Successfully opened Vault.\n")
-			s.Stop()
 			err = login.Delete()
 			if err != nil {
 				fmt.Println(red("Failed to delete login"))
@@ -88,7 +74,14 @@ func NewDeleteVaultCmd() *cobra.Command {
 		Short:   "Delete a Vault.",
 		Long:    "Delete a Vault and all associated logins. Requires the master password.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			err := vault.Get()
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			vault.Storage = db
+
+			err = vault.Get()
 			if err != nil {
 				return err
 			}
@@ -96,7 +89,10 @@ func NewDeleteVaultCmd() *cobra.Command {
 			s.Color("green")
 			s.Prefix = "Checking Master Password"
 
-			vault.Masterpass = strings.TrimSpace(prompt.PasswordPrompt("Input master password:"))
+			vault.Masterpass, err = masterSecret.read("Input master password:")
+			if err != nil {
+				return err
+			}
 			if vault.Masterpass == "" {
 				return errors.New("invalid empty master password")
 			}
@@ -106,7 +102,7 @@ func NewDeleteVaultCmd() *cobra.Command {
 			if match := vault.MasterpassMatch(); match != nil {
 				s.FinalMSG = red("Failed master password check.\n")
 				s.Stop()
-				return err
+				return match
 			}
 			s.FinalMSG = green("✓ Successfully opened Vault for deletion.\n")
 			s.Stop()
@@ -114,6 +110,7 @@ func NewDeleteVaultCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			forgetInAgent(vault.Uuid)
 			fmt.Printf("✓ Deleted logins: %d\n✓ Deleted vaults: %d\n", deleted["delete_login"], deleted["delete_vault"])
 			return nil
 		},
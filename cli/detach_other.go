@@ -0,0 +1,10 @@
+//go:build !unix
+
+package cli
+
+import "errors"
+
+// startDetached is not supported outside Unix systems.
+func startDetached(input []byte, args ...string) error {
+	return errors.New("running kittypass in the background is not supported on this platform")
+}
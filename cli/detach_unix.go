@@ -0,0 +1,37 @@
+//go:build unix
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startDetached runs kittypass again with args in a new session, without a terminal, so that it outlives the current command.
+// input is written to its standard input, keeping values that must not show in the process list out of args.
+func startDetached(input []byte, args ...string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	cmd := exec.Command(executable, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Stdin = reader
+	err = cmd.Start()
+	reader.Close()
+	if err != nil {
+		return err
+	}
+	// input is small enough to fit the pipe buffer, the write does not wait for the process to read it
+	if _, err := writer.Write(input); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"errors"
+
+	"github.com/mrtnhwtt/kittypass/internal/agent"
+	"github.com/mrtnhwtt/kittypass/internal/config"
+	"github.com/mrtnhwtt/kittypass/internal/crypto"
+	"github.com/mrtnhwtt/kittypass/internal/hibp"
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+	"github.com/mrtnhwtt/kittypass/internal/prompt"
+	"github.com/mrtnhwtt/kittypass/internal/storage"
+)
+
+// errorCode returns the code identifying the kind of an error in structured output. Codes are part of the interface
+// of kittypass for scripts: existing codes must never change. Errors of no known kind get the code "error".
+func errorCode(err error) string {
+	switch {
+	case errors.As(err, new(storage.VaultNotFound)):
+		return "vault_not_found"
+	case errors.As(err, new(storage.LoginNotFound)):
+		return "login_not_found"
+	case errors.As(err, new(storage.PolicyNotFound)):
+		return "policy_not_found"
+	case errors.As(err, new(storage.PolicyInUseError)):
+		return "policy_in_use"
+	case errors.As(err, new(storage.StorageConstraintError)):
+		return "duplicate"
+	case errors.As(err, new(storage.SchemaTooNewError)):
+		return "schema_too_new"
+	case errors.As(err, new(storage.StorageMigrationError)):
+		return "storage_migration_failed"
+	case errors.As(err, new(storage.StorageBackupError)):
+		return "storage_backup_failed"
+	case errors.As(err, new(storage.UnsupportedBackendError)):
+		return "unsupported_backend"
+	case errors.As(err, new(storage.StorageAccessError)):
+		return "storage_access_failed"
+	case errors.As(err, new(storage.StorageInitError)):
+		return "storage_init_failed"
+	case errors.As(err, new(storage.StorageUpdateError)):
+		return "storage_update_failed"
+	case errors.As(err, new(storage.StorageReadError)):
+		return "storage_read_failed"
+
+	case errors.As(err, new(kittypass.IncorrectPasswordError)):
+		return "incorrect_password"
+	case errors.As(err, new(kittypass.MalformedDataError)), errors.As(err, new(crypto.MalformedDataError)):
+		return "malformed_data"
+	case errors.As(err, new(kittypass.MigrationVerificationError)):
+		return "migration_verification_failed"
+	case errors.As(err, new(kittypass.WeakerKDFParamsError)):
+		return "weaker_kdf_params"
+	case errors.As(err, new(kittypass.RandomSourceError)):
+		return "random_source_failed"
+	case errors.As(err, new(kittypass.InvalidGeneratorError)):
+		return "invalid_generator"
+	case errors.As(err, new(kittypass.WeakPasswordError)):
+		return "weak_password"
+	case errors.As(err, new(kittypass.BreachedPasswordError)):
+		return "breached_password"
+	case errors.As(err, new(kittypass.InvalidReferenceError)):
+		return "invalid_reference"
+	case errors.As(err, new(kittypass.UnsupportedImportFormatError)):
+		return "unsupported_import_format"
+	case errors.As(err, new(kittypass.MalformedImportError)):
+		return "malformed_import"
+
+	case errors.As(err, new(crypto.TamperedDataError)):
+		return "tampered_data"
+	case errors.As(err, new(crypto.DecryptionError)):
+		return "decryption_failed"
+	case errors.As(err, new(crypto.EncryptionError)):
+		return "encryption_failed"
+	case errors.As(err, new(crypto.EncryptionKeyError)):
+		return "invalid_encryption_key"
+	case errors.As(err, new(crypto.GenEncryptionKeyError)):
+		return "key_generation_failed"
+	case errors.As(err, new(crypto.UnsupportedAlgorithmError)):
+		return "unsupported_algorithm"
+	case errors.As(err, new(crypto.UnsupportedEnvelopeError)):
+		return "unsupported_envelope"
+	case errors.As(err, new(crypto.OutdatedEnvelopeError)):
+		return "outdated_envelope"
+	case errors.As(err, new(crypto.InvalidKDFParamsError)):
+		return "invalid_kdf_params"
+
+	case errors.As(err, new(config.ConfigFileError)):
+		return "invalid_config_file"
+	case errors.As(err, new(config.InvalidSettingError)):
+		return "invalid_setting"
+
+	case errors.As(err, new(agent.NotRunningError)):
+		return "agent_not_running"
+	case errors.As(err, new(agent.AlreadyRunningError)):
+		return "agent_already_running"
+	case errors.As(err, new(agent.KeyNotFoundError)):
+		return "vault_locked"
+	case errors.As(err, new(agent.SocketError)), errors.As(err, new(agent.RequestError)):
+		return "agent_failed"
+	case errors.As(err, new(agent.UnsupportedPlatformError)):
+		return "unsupported_platform"
+
+	case errors.As(err, new(prompt.NotATerminalError)):
+		return "no_terminal"
+
+	case errors.As(err, new(hibp.FileError)):
+		return "hibp_file_unreadable"
+	case errors.As(err, new(hibp.MalformedFileError)):
+		return "hibp_file_malformed"
+	}
+	return "error"
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+	"github.com/mrtnhwtt/kittypass/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// generateRecord holds generated passwords printed as JSON or YAML.
+type generateRecord struct {
+	Mode        string   `json:"mode" yaml:"mode"`
+	EntropyBits float64  `json:"entropy_bits" yaml:"entropy_bits"`
+	Passwords   []string `json:"passwords" yaml:"passwords"`
+}
+
+func NewGenerateCmd() *cobra.Command {
+	generator := kittypass.PasswordGenerator{}
+	var count int
+	var policyName string
+	var copyPassword, jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:     "generate",
+		Aliases: []string{"gen"},
+		Short:   "Generate passwords without storing them.",
+		Long:    "Generate one or more passwords or passphrases and print them, or copy a single one to the clipboard. No vault is opened. With --output json or yaml, the passwords are printed along with their entropy.",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if jsonOutput {
+				output = outputJSON
+				if err := setupOutput(); err != nil {
+					return err
+				}
+			}
+			if copyPassword && structuredOutput() {
+				return errors.New("generated passwords cannot be copied to the clipboard when the output is json or yaml")
+			}
+			if count < 1 || count > 100 {
+				return fmt.Errorf("invalid count %d, please generate between 1 and 100 passwords", count)
+			}
+			if copyPassword && count > 1 {
+				return errors.New("only a single password can be copied to the clipboard")
+			}
+			if policyName != "" {
+				if generatorFlagsChanged(cmd) {
+					return errors.New("password generator options cannot be combined with --policy")
+				}
+				return nil
+			}
+			return generator.Validate()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if policyName != "" {
+				db, err := openStorage()
+				if err != nil {
+					return err
+				}
+				defer db.Close()
+				policy := kittypass.Policy{Storage: db, Name: policyName}
+				if err := policy.Get(); err != nil {
+					return err
+				}
+				generator = policy.Generator
+			}
+			passwords := make([]string, count)
+			for i := range passwords {
+				password, err := generator.GeneratePassword()
+				if err != nil {
+					return err
+				}
+				passwords[i] = password
+			}
+
+			if structuredOutput() {
+				mode := "password"
+				if generator.Passphrase {
+					mode = "passphrase"
+				}
+				return printResult(generateRecord{Mode: mode, EntropyBits: generator.Entropy(), Passwords: passwords})
+			}
+
+			if copyPassword {
+				if err := utils.AddToClipboard(passwords[0]); err != nil {
+					fmt.Fprintln(cmd.OutOrStdout(), passwords[0])
+					fmt.Fprintln(cmd.ErrOrStderr(), red("Failed to add password to the clipboard, printed password to the console."))
+				} else {
+					fmt.Fprintln(cmd.ErrOrStderr(), green("password added to clipboard"))
+				}
+			} else {
+				for _, password := range passwords {
+					fmt.Fprintln(cmd.OutOrStdout(), password)
+				}
+			}
+			printEntropy(cmd.ErrOrStderr(), &generator)
+			return nil
+		},
+	}
+	registerGeneratorFlags(cmd, &generator)
+	cmd.Flags().IntVarP(&count, "count", "c", 1, "Number of passwords to generate")
+	cmd.Flags().BoolVar(&copyPassword, "copy", false, "Copy the generated password to the clipboard instead of printing it")
+	cmd.Flags().StringVar(&policyName, "policy", "", "Generate passwords following a saved password policy")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the generated passwords and their entropy as JSON, same as --output json")
+	cmd.Flags().MarkDeprecated("json", "use --output json instead")
+	return cmd
+}
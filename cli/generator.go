@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+	"github.com/spf13/cobra"
+)
+
+// generatorFlagNames lists the flags added by registerGeneratorFlags.
+var generatorFlagNames = []string{
+	"lenght", "special-char", "numeral", "uppercase", "passphrase", "words", "separator",
+	"min-lowercase", "min-uppercase", "min-numeral", "min-special", "symbols", "exclude", "avoid-ambiguous", "no-repeat", "max-consecutive",
+}
+
+// registerGeneratorFlags adds the options of the password generator to cmd.
+func registerGeneratorFlags(cmd *cobra.Command, g *kittypass.PasswordGenerator) {
+	cmd.Flags().IntVarP(&g.Length, "lenght", "l", 16, "Length of the generated password")
+	cmd.Flags().BoolVarP(&g.SpecialChar, "special-char", "s", false, "Use special character in the password, or add one to the passphrase")
+	cmd.Flags().BoolVarP(&g.Numeral, "numeral", "N", false, "Add number in the password or passphrase")
+	cmd.Flags().BoolVarP(&g.Uppercase, "uppercase", "U", false, "Use uppercase and lowercase characters, or capitalize the passphrase words")
+	cmd.Flags().BoolVar(&g.Passphrase, "passphrase", false, "Generate a passphrase of words from the EFF wordlist instead of random characters")
+	cmd.Flags().IntVar(&g.Words, "words", 6, "Number of words of the generated passphrase")
+	cmd.Flags().StringVar(&g.Separator, "separator", "-", "Separator between the words of the generated passphrase")
+	cmd.Flags().IntVar(&g.MinLowercase, "min-lowercase", 0, "Minimum number of lowercase characters")
+	cmd.Flags().IntVar(&g.MinUppercase, "min-uppercase", 0, "Minimum number of uppercase characters, enables uppercase characters")
+	cmd.Flags().IntVar(&g.MinNumeral, "min-numeral", 0, "Minimum number of numbers, enables numbers")
+	cmd.Flags().IntVar(&g.MinSpecial, "min-special", 0, "Minimum number of special characters, enables special characters")
+	cmd.Flags().StringVar(&g.Symbols, "symbols", "", "Special characters allowed in the password, instead of !#$%&*+-?@^_~")
+	cmd.Flags().StringVar(&g.Exclude, "exclude", "", "Characters never used in the password")
+	cmd.Flags().BoolVar(&g.AvoidAmbiguous, "avoid-ambiguous", false, "Leave out characters easily confused with each other: 0 O 1 l I |")
+	cmd.Flags().BoolVar(&g.NoRepeat, "no-repeat", false, "Use every character at most once")
+	cmd.Flags().IntVar(&g.MaxConsecutive, "max-consecutive", 0, "Longest run of the same character allowed, 0 for no limit")
+}
+
+// generatorFlagsChanged reports whether any option of the password generator was set on the command line.
+func generatorFlagsChanged(cmd *cobra.Command) bool {
+	for _, name := range generatorFlagNames {
+		if cmd.Flags().Changed(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeGenerator summarizes the options of the password generator.
+func describeGenerator(g kittypass.PasswordGenerator) string {
+	if g.Passphrase {
+		options := []string{fmt.Sprintf("passphrase of %d words separated by %q", g.Words, g.Separator)}
+		if g.Uppercase {
+			options = append(options, "capitalized")
+		}
+		if g.Numeral {
+			options = append(options, "with a number")
+		}
+		if g.SpecialChar {
+			options = append(options, "with a special character")
+		}
+		return strings.Join(options, ", ")
+	}
+	options := []string{fmt.Sprintf("length %d", g.Length)}
+	for _, class := range []struct {
+		name    string
+		enabled bool
+		min     int
+	}{
+		{"lowercase", true, g.MinLowercase},
+		{"uppercase", g.Uppercase, g.MinUppercase},
+		{"numeral", g.Numeral, g.MinNumeral},
+		{"special", g.SpecialChar, g.MinSpecial},
+	} {
+		if class.enabled || class.min > 0 {
+			options = append(options, fmt.Sprintf("%s (min %d)", class.name, max(class.min, 1)))
+		}
+	}
+	if g.Symbols != "" {
+		options = append(options, fmt.Sprintf("symbols %q", g.Symbols))
+	}
+	if g.Exclude != "" {
+		options = append(options, fmt.Sprintf("excluding %q", g.Exclude))
+	}
+	if g.AvoidAmbiguous {
+		options = append(options, "no ambiguous characters")
+	}
+	if g.NoRepeat {
+		options = append(options, "no repeated characters")
+	}
+	if g.MaxConsecutive > 0 {
+		options = append(options, fmt.Sprintf("at most %d consecutive identical characters", g.MaxConsecutive))
+	}
+	return strings.Join(options, ", ")
+}
+
+// printEntropy reports the strength of the passwords produced by the generator to w.
+func printEntropy(w io.Writer, g *kittypass.PasswordGenerator) {
+	kind := "password"
+	if g.Passphrase {
+		kind = "passphrase"
+	}
+	fmt.Fprintf(w, "%s%s%s\n", green(fmt.Sprintf("✓ Generated %s entropy: ", kind)), blue(fmt.Sprintf("%.1f", g.Entropy())), green(" bits"))
+}
@@ -1,76 +1,90 @@
 package cli
 
 import (
-	"errors"
 	"fmt"
-	"strings"
+	"log"
 	"time"
 
-	"github.com/briandowns/spinner"
 	"github.com/mrtnhwtt/kittypass/internal/kittypass"
-	"github.com/mrtnhwtt/kittypass/internal/prompt"
 	"github.com/mrtnhwtt/kittypass/internal/utils"
 	"github.com/spf13/cobra"
 )
 
+// getRecord is a decrypted login printed as JSON or YAML.
+type getRecord struct {
+	Vault    string `json:"vault" yaml:"vault"`
+	Name     string `json:"name" yaml:"name"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+}
+
 func NewGetCmd() *cobra.Command {
 	login := kittypass.NewLogin()
 	vault := kittypass.NewVault()
 	login.Vault = &vault
+	var noClear bool
+	var clearAfter time.Duration
 
 	cmd := &cobra.Command{
 		Use:     "get",
 		Aliases: []string{"fetch", "copy"},
 		Short:   "get a login",
-		Long:    "get a login from a vault, adds the password to the clipboard",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
-			s.Color("green")
-			s.Prefix = "Checking Master Password"
-
-			login.Vault.Masterpass = strings.TrimSpace(prompt.PasswordPrompt("Input master password:"))
-			if login.Vault.Masterpass == "" {
-				return errors.New("invalid empty master password")
+		Long:    "get a login from a vault, adds the password to the clipboard. The clipboard is cleared after a while if it still holds the password. With --output json or yaml, the login and its password are printed instead.",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("clear-after") {
+				clearAfter = conf.ClipboardTimeout
 			}
-
-			s.Start()
-			err := login.Vault.Get()
+			if clearAfter < 0 {
+				return fmt.Errorf("invalid clipboard timeout %s, please set a duration of 0 or more", clearAfter)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openStorage()
 			if err != nil {
-				s.FinalMSG = red("Master Password check failed.\n")
-				s.Stop()
 				return err
 			}
-			if match := login.Vault.MasterpassMatch(); match != nil {
-				s.FinalMSG = red("Master Password check failed.\n")
-				s.Stop()
-				return errors.New("incorrect password")
-			}
-			err = login.Vault.RecreateDerivationKey()
+			defer db.Close()
+			login.Vault.Storage = db
+
+			err = unlockVault(login.Vault)
 			if err != nil {
-				s.FinalMSG = red("Opening Vault failed.\n")
-				s.Stop()
 				return err
 			}
-			s.FinalMSG = green("✓ Successfully opened Vault.\n")
-			s.Stop()
 			login, err := login.Get()
 			if err != nil {
 				return err
 			}
+			if structuredOutput() {
+				return printResult(getRecord{Vault: vault.Name, Name: login["name"], Username: login["username"], Password: login["password"]})
+			}
 			fmt.Printf("\n%s%s\n", blue("Login Name: "), login["name"])
 			fmt.Printf("%s%s\n", blue("Usename: "), login["username"])
 			err = utils.AddToClipboard(login["password"])
 			if err != nil {
 				fmt.Printf("%s%s\n", blue("Password: "), login["password"])
 				fmt.Println(red("Failed to add password to the clipboard, printed password to the console."))
-			} else {
+				return nil
+			}
+			if noClear || clearAfter == 0 {
+				fmt.Println(green("password added to clipboard"))
+				return nil
+			}
+			if err := scheduleClipboardClear(login["password"], clearAfter); err != nil {
+				log.Printf("failed to start clearing the clipboard: %s", err)
 				fmt.Println(green("password added to clipboard"))
+				fmt.Println(red("Failed to schedule clearing the clipboard, clear it yourself."))
+				return nil
 			}
+			fmt.Printf("%s %s\n", green("password added to clipboard, cleared in"), blue(clearAfter))
 			return nil
 		},
 	}
 	cmd.Flags().StringVarP(&login.Name, "name", "n", "", "login's name")
 	cmd.Flags().StringVarP(&login.Vault.Name, "vault", "v", "", "vault's name")
+	cmd.Flags().BoolVar(&noClear, "no-clear", false, "Leave the password in the clipboard")
+	cmd.Flags().DurationVar(&clearAfter, "clear-after", 0, "Clear the clipboard after this long, defaults to the clipboard_timeout setting")
+	cmd.MarkFlagsMutuallyExclusive("no-clear", "clear-after")
 	cmd.MarkFlagRequired("name")
 	cmd.MarkFlagRequired("vault")
 	return cmd
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+	"github.com/spf13/cobra"
+)
+
+// importedRecord is a login of an import printed as JSON or YAML. It never holds the password.
+type importedRecord struct {
+	Name     string `json:"name" yaml:"name"`
+	Username string `json:"username" yaml:"username"`
+	Line     int    `json:"line" yaml:"line"`
+}
+
+// importRecord is the report of an import printed as JSON or YAML.
+type importRecord struct {
+	Vault      string           `json:"vault" yaml:"vault"`
+	DryRun     bool             `json:"dry_run" yaml:"dry_run"`
+	Imported   []importedRecord `json:"imported" yaml:"imported"`
+	Duplicates []importedRecord `json:"duplicates" yaml:"duplicates"`
+	Skipped    int              `json:"skipped" yaml:"skipped"`
+}
+
+func NewImportCmd() *cobra.Command {
+	vault := kittypass.NewVault()
+	var format string
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "import --format <format> --vault <vault> <file>",
+		Short: "Import logins from the CSV export of another password manager.",
+		Long: fmt.Sprintf("Import the logins of a CSV export into a Vault, in a single transaction. Supported formats are %s. ", strings.Join(kittypass.ImportFormats, ", ")) +
+			"Logins whose name is already used in the Vault, or earlier in the export, are reported and left out. Logins without a name are named after the host of their URL and their username. " +
+			"URLs and notes are not imported. With --dry-run, the import is reported but nothing is saved.",
+		Args: cobra.ExactArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if !slices.Contains(kittypass.ImportFormats, format) {
+				return kittypass.UnsupportedImportFormatError{Format: format}
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			logins, skipped, err := kittypass.ParseImport(format, file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			vault.Storage = db
+
+			if err := unlockVault(&vault); err != nil {
+				return err
+			}
+
+			s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
+			s.Color("green")
+			s.Prefix = "Importing logins"
+			s.Start()
+			report, err := vault.Import(logins, dryRun)
+			if err != nil {
+				s.FinalMSG = red("Import failed, no login was saved.\n")
+				s.Stop()
+				return err
+			}
+			s.Stop()
+
+			if structuredOutput() {
+				return printResult(importRecord{
+					Vault:      vault.Name,
+					DryRun:     dryRun,
+					Imported:   importedRecords(report.Imported),
+					Duplicates: importedRecords(report.Duplicates),
+					Skipped:    skipped,
+				})
+			}
+			printImportReport(report, skipped, dryRun)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&vault.Name, "vault", "v", "", "Name of the vault to import the logins into")
+	cmd.Flags().StringVarP(&format, "format", "f", "", fmt.Sprintf("Format of the export: %s", strings.Join(kittypass.ImportFormats, ", ")))
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report what would be imported without saving anything")
+	cmd.MarkFlagRequired("vault")
+	cmd.MarkFlagRequired("format")
+	return cmd
+}
+
+func importedRecords(logins []kittypass.ImportedLogin) []importedRecord {
+	records := []importedRecord{}
+	for _, login := range logins {
+		records = append(records, importedRecord{Name: login.Name, Username: login.Username, Line: login.Line})
+	}
+	return records
+}
+
+func printImportReport(report kittypass.ImportReport, skipped int, dryRun bool) {
+	fmt.Println("------------------------------------------------------------------------------")
+	if dryRun {
+		fmt.Printf("%s%s%s\n", green("Dry run, "), blue(len(report.Imported)), green(" Logins would be imported:"))
+	} else {
+		fmt.Printf("%s%s%s\n", green("✓ Imported "), blue(len(report.Imported)), green(" Logins."))
+	}
+	if dryRun {
+		for _, login := range report.Imported {
+			fmt.Printf("  - %s\n", describeImportedLogin(login))
+		}
+	}
+	if len(report.Duplicates) > 0 {
+		fmt.Printf("%s\n", magenta(fmt.Sprintf("%d Logins were left out, their name is already used:", len(report.Duplicates))))
+		for _, login := range report.Duplicates {
+			fmt.Printf("  - line %d: %s\n", login.Line, describeImportedLogin(login))
+		}
+	}
+	if skipped > 0 {
+		fmt.Printf("%s\n", magenta(fmt.Sprintf("%d entries were skipped as they are not logins.", skipped)))
+	}
+	fmt.Println("------------------------------------------------------------------------------")
+}
+
+// describeImportedLogin returns the name of a login followed by its username, unless the name was made from it.
+func describeImportedLogin(login kittypass.ImportedLogin) string {
+	if login.Username == "" || strings.HasSuffix(login.Name, "("+login.Username+")") {
+		return login.Name
+	}
+	return fmt.Sprintf("%s (%s)", login.Name, login.Username)
+}
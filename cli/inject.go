@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+	"github.com/spf13/cobra"
+)
+
+// templateReference matches the references of a template: {{ kp://<vault>/<login>/<field> }}.
+var templateReference = regexp.MustCompile(`\{\{\s*(kp://[^\s{}]*)\s*\}\}`)
+
+func NewReadCmd() *cobra.Command {
+	var noNewline bool
+
+	cmd := &cobra.Command{
+		Use:   "read kp://<vault>/<login>/<password|username>",
+		Short: "Print the value a reference points at.",
+		Long:  "Unlock the Vault of a reference and print the password or username of the login it points at. Every other message goes to stderr.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ref, err := kittypass.ParseReference(args[0])
+			if err != nil {
+				return err
+			}
+			sendMessagesToStderr()
+
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			resolver := kittypass.Resolver{Storage: db, Unlock: unlockVault}
+			values, err := resolver.Resolve([]kittypass.Reference{ref})
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(resultOut, values[ref])
+			if !noNewline {
+				fmt.Fprintln(resultOut)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&noNewline, "no-newline", "n", false, "Do not print a newline after the value")
+	return cmd
+}
+
+func NewInjectCmd() *cobra.Command {
+	var inputPath, outputPath string
+
+	cmd := &cobra.Command{
+		Use:   "inject",
+		Short: "Render a template, replacing references with their values.",
+		Long: "Render a template, replacing every {{ kp://<vault>/<login>/<password|username> }} with the value it points at. " +
+			"All references are checked before any Vault is unlocked, and each Vault is unlocked once. " +
+			"The template is read from stdin and written to stdout unless --in-file and --out-file are given. The output file is only readable by you.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var template []byte
+			var err error
+			if inputPath == "" {
+				template, err = io.ReadAll(os.Stdin)
+			} else {
+				template, err = os.ReadFile(inputPath)
+			}
+			if err != nil {
+				return err
+			}
+			refs, err := templateReferences(template)
+			if err != nil {
+				return err
+			}
+			if outputPath == "" {
+				sendMessagesToStderr()
+			}
+
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			resolver := kittypass.Resolver{Storage: db, Unlock: unlockVault}
+			values, err := resolver.Resolve(refs)
+			if err != nil {
+				return err
+			}
+			rendered := templateReference.ReplaceAllFunc(template, func(match []byte) []byte {
+				ref, _ := kittypass.ParseReference(string(templateReference.FindSubmatch(match)[1]))
+				return []byte(values[ref])
+			})
+
+			if outputPath == "" {
+				_, err = resultOut.Write(rendered)
+				return err
+			}
+			if err := writePrivateFile(outputPath, rendered); err != nil {
+				return err
+			}
+			fmt.Printf("%s%s%s %s\n", green("✓ Replaced "), blue(len(refs)), green(" references, rendered template written to"), blue(outputPath))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&inputPath, "in-file", "i", "", "Template to render, read from stdin when not given")
+	cmd.Flags().StringVarP(&outputPath, "out-file", "o", "", "File the rendered template is written to, stdout when not given")
+	return cmd
+}
+
+// templateReferences parses every reference of a template, reporting the line of the first invalid one.
+func templateReferences(template []byte) ([]kittypass.Reference, error) {
+	var refs []kittypass.Reference
+	for _, match := range templateReference.FindAllSubmatchIndex(template, -1) {
+		ref, err := kittypass.ParseReference(string(template[match[2]:match[3]]))
+		if err != nil {
+			line := bytes.Count(template[:match[0]], []byte("\n")) + 1
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// writePrivateFile writes data to path, only readable by the current user. An existing file has its permissions
+// restricted before anything is written to it.
+func writePrivateFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
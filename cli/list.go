@@ -25,6 +25,21 @@ func NewListCmd() *cobra.Command {
 	return cmd
 }
 
+// loginRecord is a login listed as JSON or YAML.
+type loginRecord struct {
+	Vault    string `json:"vault" yaml:"vault"`
+	Name     string `json:"name" yaml:"name"`
+	Username string `json:"username" yaml:"username"`
+	Created  string `json:"created" yaml:"created"`
+}
+
+// vaultRecord is a vault listed as JSON or YAML.
+type vaultRecord struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	Created     string `json:"created" yaml:"created"`
+}
+
 func NewListLoginCmd() *cobra.Command {
 	login := kittypass.NewLogin()
 	vault := kittypass.NewVault()
@@ -36,6 +51,13 @@ func NewListLoginCmd() *cobra.Command {
 		Short:   "lists logins",
 		Long:    "lists logins. Search for login from login name, username or email. Limit search to a specific vault",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			login.Vault.Storage = db
+
 			if login.Vault.Name != "" {
 				err := login.Vault.Get()
 				if err != nil {
@@ -46,6 +68,13 @@ func NewListLoginCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if structuredOutput() {
+				records := make([]loginRecord, 0, len(loginList))
+				for _, login := range loginList {
+					records = append(records, loginRecord{Vault: login["vault_name"], Name: login["name"], Username: login["username"], Created: login["timestamp"]})
+				}
+				return printResult(records)
+			}
 			if len(loginList) < 1 {
 				fmt.Println(red("No matching logins"))
 				return nil
@@ -76,9 +105,23 @@ func NewListVaultCmd() *cobra.Command {
 		Short:   "lists vaults",
 		Long:    "lists vaults. Search for a vault by providing a name.",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			vault.Storage = db
+
 			vaultList, err := vault.List()
 			if err != nil {
-				return nil
+				return err
+			}
+			if structuredOutput() {
+				records := make([]vaultRecord, 0, len(vaultList))
+				for _, vault := range vaultList {
+					records = append(records, vaultRecord{Name: vault["name"], Description: vault["description"], Created: vault["date_created"]})
+				}
+				return printResult(records)
 			}
 			if len(vaultList) < 1 {
 				fmt.Println(red("No matching vaults"))
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+)
+
+// concealed replaces the secrets found in the output of a child process.
+const concealed = "<concealed by kittypass>"
+
+// maskingWriter copies what is written to it to w, replacing every occurrence of the secrets with concealed.
+// A secret can be split across writes: the end of a write that could be the beginning of a secret is held back
+// until the next write tells, or until Close.
+type maskingWriter struct {
+	w       io.Writer
+	secrets [][]byte
+	pending []byte
+	mu      sync.Mutex
+}
+
+func newMaskingWriter(w io.Writer, secrets []string) *maskingWriter {
+	m := &maskingWriter{w: w}
+	for _, secret := range secrets {
+		if secret != "" {
+			m.secrets = append(m.secrets, []byte(secret))
+		}
+	}
+	// the longest secrets are masked first, so that a secret containing a shorter one is masked whole
+	sort.Slice(m.secrets, func(i, j int) bool { return len(m.secrets[i]) > len(m.secrets[j]) })
+	return m
+}
+
+func (m *maskingWriter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending = append(m.pending, p...)
+	if err := m.flush(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes what was held back.
+func (m *maskingWriter) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.flush(true)
+}
+
+func (m *maskingWriter) flush(final bool) error {
+	var out bytes.Buffer
+	i := 0
+scan:
+	for i < len(m.pending) {
+		rest := m.pending[i:]
+		for _, secret := range m.secrets {
+			if bytes.HasPrefix(rest, secret) {
+				out.WriteString(concealed)
+				i += len(secret)
+				continue scan
+			}
+		}
+		if !final {
+			for _, secret := range m.secrets {
+				if len(rest) < len(secret) && bytes.HasPrefix(secret, rest) {
+					break scan
+				}
+			}
+		}
+		out.WriteByte(m.pending[i])
+		i++
+	}
+	m.pending = append(m.pending[:0], m.pending[i:]...)
+	_, err := m.w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+	"github.com/mrtnhwtt/kittypass/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+func NewMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "migrate a vault between storages",
+		Long:  "migrate a vault and its logins from one storage backend to another",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	cmd.AddCommand(
+		NewMigrateVaultCmd(),
+	)
+	return cmd
+}
+
+func NewMigrateVaultCmd() *cobra.Command {
+	vault := kittypass.NewVault()
+	var from, to string
+	var deleteSource bool
+
+	cmd := &cobra.Command{
+		Use:     "vault",
+		Aliases: []string{"folder"},
+		Short:   "Migrate a Vault to another storage.",
+		Long: "Copy a Vault and all its logins from one storage backend to another. Passwords are copied encrypted and the copy is verified at the destination. " +
+			"Backends are given as a database path or as sqlite://<path>. Deleting the source Vault requires the master password.",
+		Example: "kittypass migrate vault --name myVault --from ./database.db --to sqlite:///home/martin/kittypass.db",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			src, err := storage.Open(from)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			vault.Storage = src
+
+			dst, err := storage.Open(to)
+			if err != nil {
+				return err
+			}
+			defer dst.Close()
+
+			if deleteSource {
+				err = vault.Get()
+				if err != nil {
+					return err
+				}
+				vault.Masterpass, err = masterSecret.read("Input master password:")
+				if err != nil {
+					return err
+				}
+				if vault.Masterpass == "" {
+					return errors.New("invalid empty master password")
+				}
+				if err := vault.MasterpassMatch(); err != nil {
+					fmt.Println(red("Master Password check failed."))
+					return err
+				}
+			}
+
+			s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
+			s.Color("green")
+			s.Prefix = "Migrating Vault"
+			s.Start()
+
+			result, err := vault.Migrate(dst, deleteSource)
+			if err != nil {
+				s.FinalMSG = red("Vault migration failed.\n")
+				s.Stop()
+				return err
+			}
+			s.FinalMSG = fmt.Sprintf("%s %s %s %s %s\n", green("✓ Successfully migrated Vault"), blue(vault.Name), green("with"), blue(result.Logins), green("logins."))
+			s.Stop()
+			fmt.Printf("%s%s\n", blue("Checksum: "), result.Checksum)
+			if result.SourceDeleted {
+				fmt.Println(green("✓ Deleted Vault from source storage."))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&vault.Name, "name", "n", "", "Name of the Vault to migrate")
+	cmd.Flags().StringVar(&from, "from", "", "Storage backend to migrate the Vault from")
+	cmd.Flags().StringVar(&to, "to", "", "Storage backend to migrate the Vault to")
+	cmd.Flags().BoolVar(&deleteSource, "delete-source", false, "Delete the Vault from the source storage once migrated")
+	cmd.MarkFlagRequired("name")
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagRequired("to")
+	return cmd
+}
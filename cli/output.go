@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// output is the format of the results of commands, set by the global --output flag.
+var output = outputTable
+
+// resultOut receives the results of commands printed as JSON or YAML, and the values printed by read and inject.
+var resultOut io.Writer = os.Stdout
+
+// setupOutput checks the output format. When results are printed as JSON or YAML, the messages meant for people
+// are sent to stderr so that stdout only holds the results.
+func setupOutput() error {
+	switch output {
+	case outputTable:
+		return nil
+	case outputJSON, outputYAML:
+	default:
+		invalid := output
+		output = outputTable
+		return fmt.Errorf("invalid output format %s, please use one of %s, %s or %s", invalid, outputTable, outputJSON, outputYAML)
+	}
+	sendMessagesToStderr()
+	return nil
+}
+
+// sendMessagesToStderr keeps stdout for the results of the command, written to resultOut, and sends every other message
+// to stderr, spinners included.
+func sendMessagesToStderr() {
+	if os.Stdout == os.Stderr {
+		return
+	}
+	resultOut = os.Stdout
+	os.Stdout = os.Stderr
+	color.Output = color.Error
+}
+
+// structuredOutput reports whether results are printed as JSON or YAML instead of tables.
+func structuredOutput() bool {
+	return output != outputTable
+}
+
+// printResult prints the result of a command in the output format. It must only be called when the output is structured.
+func printResult(result interface{}) error {
+	return writeStructured(resultOut, result)
+}
+
+func writeStructured(w io.Writer, value interface{}) error {
+	if output == outputYAML {
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+type errorRecord struct {
+	Code    string `json:"code" yaml:"code"`
+	Message string `json:"message" yaml:"message"`
+}
+
+// PrintError reports an error returned by a command on stderr. When the output is structured, the error is printed
+// in the output format along with a stable code identifying its kind.
+func PrintError(err error) {
+	if !structuredOutput() {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return
+	}
+	record := map[string]errorRecord{"error": {Code: errorCode(err), Message: err.Error()}}
+	if writeErr := writeStructured(os.Stderr, record); writeErr != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+	"github.com/spf13/cobra"
+)
+
+func NewPolicyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "policy",
+		Aliases: []string{"policies"},
+		Short:   "Manage password policies.",
+		Long:    "Manage named password policies. A login created or updated with a policy keeps generating passwords following it.",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	cmd.AddCommand(
+		NewAddPolicyCmd(),
+		NewListPolicyCmd(),
+		NewDeletePolicyCmd(),
+	)
+	return cmd
+}
+
+func NewAddPolicyCmd() *cobra.Command {
+	policy := kittypass.Policy{}
+	cmd := &cobra.Command{
+		Use:     "add",
+		Aliases: []string{"new"},
+		Short:   "Save a password policy.",
+		Long:    "Save the password generator options as a named policy, e.g. the rules a site enforces on its passwords.",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return policy.Generator.Validate()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			policy.Storage = db
+
+			if err := policy.Save(); err != nil {
+				return err
+			}
+			fmt.Printf("%s %s: %s\n", green("✓ Saved policy"), blue(policy.Name), describeGenerator(policy.Generator))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&policy.Name, "name", "n", "", "Name of the policy")
+	registerGeneratorFlags(cmd, &policy.Generator)
+	cmd.MarkFlagRequired("name")
+	return cmd
+}
+
+func NewListPolicyCmd() *cobra.Command {
+	policy := kittypass.Policy{}
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List password policies.",
+		Long:    "List the saved password policies and their options.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			policy.Storage = db
+
+			policies, err := policy.List()
+			if err != nil {
+				return err
+			}
+			if len(policies) < 1 {
+				fmt.Println(red("No saved policies"))
+				return nil
+			}
+			for _, p := range policies {
+				fmt.Println("------------------------------------------------------------------------------")
+				fmt.Printf("Policy: %s\nOptions: %s\n", p.Name, describeGenerator(p.Generator))
+			}
+			fmt.Println("------------------------------------------------------------------------------")
+			return nil
+		},
+	}
+	return cmd
+}
+
+func NewDeletePolicyCmd() *cobra.Command {
+	policy := kittypass.Policy{}
+	cmd := &cobra.Command{
+		Use:     "delete",
+		Aliases: []string{"rm", "remove"},
+		Short:   "Delete a password policy.",
+		Long:    "Delete a password policy. Policies still used by logins are not deleted.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			policy.Storage = db
+
+			if err := policy.Delete(); err != nil {
+				return err
+			}
+			fmt.Printf("%s %s\n", green("✓ Deleted policy"), blue(policy.Name))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&policy.Name, "name", "n", "", "Name of the policy")
+	cmd.MarkFlagRequired("name")
+	return cmd
+}
@@ -1,27 +1,54 @@
 package cli
 
 import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
 	"github.com/fatih/color"
+	"github.com/mrtnhwtt/kittypass/internal/config"
+	"github.com/mrtnhwtt/kittypass/internal/storage"
 	"github.com/spf13/cobra"
-	
 )
 
 var (
-	green = color.New(color.FgGreen).SprintFunc()
-	red   = color.New(color.FgRed).SprintFunc()
-	blue = color.New(color.FgBlue).SprintFunc()
+	green   = color.New(color.FgGreen).SprintFunc()
+	red     = color.New(color.FgRed).SprintFunc()
+	blue    = color.New(color.FgBlue).SprintFunc()
 	magenta = color.New(color.FgMagenta).SprintFunc()
-
 )
 
+// conf is the configuration resolved before any command runs.
+var conf config.Config
+
 func NewRootCmd() *cobra.Command {
 
 	cmd := &cobra.Command{
-		Use:   "kittypass",
-		Short: "A CLI password manager",
-		Long:  "A CLI password manager to securely stock your password.",
-		SilenceUsage: true,
+		Use:           "kittypass",
+		Short:         "A CLI password manager",
+		Long:          "A CLI password manager to securely stock your password.",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupOutput(); err != nil {
+				return err
+			}
+			var err error
+			conf, err = config.Load(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			masterSecret.useDefaultFile(conf.MasterPasswordFile)
+			if conf.MovedDatabase != "" {
+				fmt.Fprintln(cmd.ErrOrStderr(), magenta(fmt.Sprintf("Using the database %s found at the former default location. The default is now %s: move it there, or set its location with --db, KITTYPASS_DB or the config file.", conf.Database, conf.MovedDatabase)))
+			}
+			return setupLogging(conf.LogFile)
+		},
 	}
+	cmd.PersistentFlags().String("db", "", "Path to the database. Overrides KITTYPASS_DB and the config file")
+	registerMasterSecretFlags(cmd)
+	cmd.PersistentFlags().StringVar(&output, "output", outputTable, "Format of the results of list, get, generate and import: table, json or yaml")
 
 	cmd.AddCommand(
 		NewAddCmd(),
@@ -29,8 +56,40 @@ func NewRootCmd() *cobra.Command {
 		NewListCmd(),
 		NewDeleteCmd(),
 		NewUpdateCmd(),
+		NewMigrateCmd(),
+		NewRotateKeyCmd(),
+		NewGenerateCmd(),
+		NewPolicyCmd(),
+		NewAuditCmd(),
+		NewAgentCmd(),
+		NewUnlockCmd(),
+		NewLockCmd(),
+		NewRunCmd(),
+		NewReadCmd(),
+		NewInjectCmd(),
+		NewImportCmd(),
+		NewClearClipboardCmd(),
+		NewVaultCmd(),
 	)
-	// TODO: implement a migration command to migrate a vault between different storage.
 
 	return cmd
 }
+
+// openStorage opens the storage backend that commands inject into the vaults and logins they work on.
+// The caller is responsible for closing it.
+func openStorage() (storage.Backend, error) {
+	return storage.Open(conf.Database)
+}
+
+func setupLogging(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	log.SetOutput(file)
+	return nil
+}
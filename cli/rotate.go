@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/mrtnhwtt/kittypass/internal/crypto"
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+	"github.com/spf13/cobra"
+)
+
+func NewRotateKeyCmd() *cobra.Command {
+	vault := kittypass.NewVault()
+	var newCipher string
+
+	cmd := &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Rotate the data key of a Vault.",
+		Long: "Replace the data key of a Vault with a new random key and re-encrypt every login under it. " +
+			"Changing the master password does not re-encrypt logins, use this command when the logins themselves must be re-encrypted, or to switch the Vault to another encryption algorithm.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			vault.Storage = db
+
+			err = unlockVault(&vault)
+			if err != nil {
+				return err
+			}
+
+			s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
+			s.Color("green")
+			s.Prefix = "Rotating Vault key"
+			s.Start()
+
+			rotated, err := vault.RotateKey(newCipher)
+			if err != nil {
+				s.FinalMSG = red("Rotating Vault key failed.\n")
+				s.Stop()
+				return err
+			}
+			s.FinalMSG = fmt.Sprintf("%s%s%s\n", green("✓ Successfully rotated Vault key and re-encrypted "), blue(rotated), green(" Logins."))
+			s.Stop()
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&vault.Name, "vault", "v", "", "vault's name")
+	cmd.Flags().StringVar(&newCipher, "cipher", "", fmt.Sprintf("Switch the Vault to another encryption algorithm, one of %s or %s", crypto.AES, crypto.XChaCha20Poly1305))
+	cmd.MarkFlagRequired("vault")
+	return cmd
+}
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+	"github.com/spf13/cobra"
+)
+
+// ExitError reports the exit status of a child process, which kittypass exits with.
+type ExitError struct {
+	Code int
+}
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("command exited with status %d", e.Code)
+}
+
+// envSecret is an environment variable set to a field of a login: NAME=login:<login>[:password|username].
+type envSecret struct {
+	Name  string
+	Login string
+	Field string
+}
+
+func parseEnvSecret(spec string) (envSecret, error) {
+	name, ref, found := strings.Cut(spec, "=")
+	if !found || name == "" || strings.ContainsAny(name, " \t") {
+		return envSecret{}, fmt.Errorf("invalid --env %q, expected NAME=login:<login>[:password|username]", spec)
+	}
+	login, found := strings.CutPrefix(ref, "login:")
+	if !found || login == "" {
+		return envSecret{}, fmt.Errorf("invalid --env %q, expected NAME=login:<login>[:password|username]", spec)
+	}
+	field := "password"
+	if i := strings.LastIndex(login, ":"); i >= 0 && (login[i+1:] == "password" || login[i+1:] == "username") {
+		login, field = login[:i], login[i+1:]
+	}
+	return envSecret{Name: name, Login: login, Field: field}, nil
+}
+
+func NewRunCmd() *cobra.Command {
+	vault := kittypass.NewVault()
+	var specs []string
+	var noMask bool
+	var secrets []envSecret
+
+	cmd := &cobra.Command{
+		Use:   "run --vault <vault> --env NAME=login:<login>[:field] -- <command> [args...]",
+		Short: "Run a command with secrets in its environment.",
+		Long: "Unlock a Vault and run a command with environment variables set to the password or username of logins. " +
+			"The field is password when it is not given. The passwords are masked in the output of the command, unless --no-mask is set.",
+		Args: cobra.MinimumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			for _, spec := range specs {
+				secret, err := parseEnvSecret(spec)
+				if err != nil {
+					return err
+				}
+				secrets = append(secrets, secret)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			vault.Storage = db
+
+			err = unlockVault(&vault)
+			if err != nil {
+				return err
+			}
+
+			logins := map[string]map[string]string{}
+			env := os.Environ()
+			var passwords []string
+			for _, secret := range secrets {
+				stored, found := logins[secret.Login]
+				if !found {
+					login := kittypass.NewLogin()
+					login.Vault = &vault
+					login.Name = secret.Login
+					stored, err = login.Get()
+					if err != nil {
+						return fmt.Errorf("failed to read login %s: %w", secret.Login, err)
+					}
+					logins[secret.Login] = stored
+				}
+				env = append(env, secret.Name+"="+stored[secret.Field])
+				// usernames are not secret, and a short one would mask unrelated output
+				if secret.Field == "password" {
+					passwords = append(passwords, stored[secret.Field])
+				}
+			}
+
+			return runChild(args, env, passwords, noMask)
+		},
+	}
+	cmd.Flags().StringVarP(&vault.Name, "vault", "v", "", "vault's name")
+	cmd.Flags().StringArrayVarP(&specs, "env", "e", nil, "Set an environment variable to a field of a login: NAME=login:<login>[:password|username], repeat for several variables")
+	cmd.Flags().BoolVar(&noMask, "no-mask", false, "Do not mask the passwords in the output of the command, which then writes to the terminal directly")
+	cmd.MarkFlagRequired("vault")
+	cmd.MarkFlagRequired("env")
+	return cmd
+}
+
+// runChild runs args with env, masking the secrets in its output unless noMask is set, and waits for it.
+// Interrupts are forwarded to the child, whose exit status is returned as an ExitError.
+func runChild(args, env, secrets []string, noMask bool) error {
+	child := exec.Command(args[0], args[1:]...)
+	child.Env = env
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	if !noMask {
+		stdout := newMaskingWriter(os.Stdout, secrets)
+		stderr := newMaskingWriter(os.Stderr, secrets)
+		defer stdout.Close()
+		defer stderr.Close()
+		child.Stdout = stdout
+		child.Stderr = stderr
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	if err := child.Start(); err != nil {
+		return err
+	}
+	go func() {
+		for sig := range signals {
+			child.Process.Signal(sig)
+		}
+	}()
+
+	err := child.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			// shells report a command killed by a signal with 128 plus the signal number
+			return ExitError{Code: 128 + int(status.Signal())}
+		}
+		return ExitError{Code: exitErr.ExitCode()}
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mrtnhwtt/kittypass/internal/prompt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// secretSource is where a password is read from: standard input, a file, or else a prompt on the terminal.
+type secretSource struct {
+	stdin bool
+	file  string
+	// name describes the password in errors, and flag is the prefix of the flags choosing the source.
+	name string
+	flag string
+}
+
+// masterSecret is the source of master passwords, chosen by the global --password-stdin and --password-file flags.
+var masterSecret = secretSource{name: "master password", flag: "password"}
+
+func (s *secretSource) register(flags *pflag.FlagSet, env string) {
+	flags.BoolVar(&s.stdin, s.flag+"-stdin", false, fmt.Sprintf("Read the %s from a line of standard input instead of prompting", s.name))
+	flags.StringVar(&s.file, s.flag+"-file", "", fmt.Sprintf("Read the %s from the first line of a file instead of prompting. Overrides %s", s.name, env))
+}
+
+// useDefaultFile reads the password from file when no source was chosen with flags.
+func (s *secretSource) useDefaultFile(file string) {
+	if !s.stdin && s.file == "" {
+		s.file = file
+	}
+}
+
+// prompted reports whether the password is typed at a prompt, and so should be confirmed when it is a new one.
+func (s *secretSource) prompted() bool {
+	return !s.stdin && s.file == ""
+}
+
+// read returns the password, prompting for it with label when it is not read from standard input or a file.
+func (s *secretSource) read(label string) (string, error) {
+	var secret string
+	var err error
+	switch {
+	case s.stdin:
+		secret, err = readStdinLine()
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("no %s left to read on standard input", s.name)
+		}
+	case s.file != "":
+		secret, err = readSecretFile(s.file)
+	default:
+		secret, err = prompt.PasswordPrompt(label)
+		var notATerminal prompt.NotATerminalError
+		if errors.As(err, &notATerminal) {
+			return "", fmt.Errorf("%w, provide the %s with --%s-stdin or --%s-file", err, s.name, s.flag, s.flag)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(secret), nil
+}
+
+// stdinLines reads standard input line by line, so that a master password and a login password can follow each other on it.
+var stdinLines = bufio.NewReader(os.Stdin)
+
+func readStdinLine() (string, error) {
+	line, err := stdinLines.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(content), "\n")
+	return strings.TrimRight(line, "\r"), nil
+}
+
+// registerMasterSecretFlags adds the flags choosing the source of master passwords to the root command.
+func registerMasterSecretFlags(cmd *cobra.Command) {
+	masterSecret.register(cmd.PersistentFlags(), "KITTYPASS_MASTER_PASSWORD_FILE")
+	cmd.MarkFlagsMutuallyExclusive("password-stdin", "password-file")
+}
+
+// newLoginSecret returns the source of the password of a login and adds the flags choosing it to cmd.
+func newLoginSecret(cmd *cobra.Command) *secretSource {
+	s := &secretSource{name: "login password", flag: "login-password"}
+	s.register(cmd.Flags(), "KITTYPASS_LOGIN_PASSWORD_FILE")
+	cmd.MarkFlagsMutuallyExclusive("login-password-stdin", "login-password-file")
+	return s
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/mrtnhwtt/kittypass/internal/hibp"
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+)
+
+// checkStrength prints the estimated strength of a password typed by the user and rejects it when its score is below
+// the configured minimum, unless force is set. userInputs are words an attacker would associate with the password, such as the login name.
+func checkStrength(password string, force bool, userInputs ...string) error {
+	strength := kittypass.EstimateStrength(password, userInputs...)
+	score := green
+	if strength.Score < conf.MinPasswordScore {
+		score = red
+	}
+	fmt.Printf("%s %s %s %s\n", blue("Password strength:"), score(fmt.Sprintf("%d/4 (%s)", strength.Score, strength.Label())), blue("estimated crack time:"), strength.CrackTime())
+	if strength.Warning != "" {
+		fmt.Println(magenta(strength.Warning))
+	}
+	for _, suggestion := range strength.Suggestions {
+		fmt.Println(magenta("  - " + suggestion))
+	}
+	if strength.Score >= conf.MinPasswordScore {
+		return nil
+	}
+	if force {
+		fmt.Println(magenta("Keeping the weak password as --force is set."))
+		return nil
+	}
+	return kittypass.WeakPasswordError{Score: strength.Score, Minimum: conf.MinPasswordScore}
+}
+
+// checkBreached looks a password typed by the user up in the Have I Been Pwned password list at hibpFile and rejects it
+// when it was seen in a breach, unless force is set. Nothing is checked when hibpFile is empty.
+func checkBreached(password, hibpFile string, force bool) error {
+	if hibpFile == "" {
+		return nil
+	}
+	list, err := hibp.Open(hibpFile)
+	if err != nil {
+		return err
+	}
+	defer list.Close()
+	count, err := list.Count(password)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		fmt.Println(green("✓ Password not found in breached passwords"))
+		return nil
+	}
+	fmt.Println(red(fmt.Sprintf("✗ Password was seen %d times in data breaches.", count)))
+	if force {
+		fmt.Println(magenta("Keeping the breached password as --force is set."))
+		return nil
+	}
+	return kittypass.BreachedPasswordError{Occurrences: count}
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/mrtnhwtt/kittypass/internal/agent"
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+)
+
+// unlockVault recreates the key used to read and write the logins of the vault, with the key held by the agent when the vault
+// is unlocked there, or else from the master password it prompts for. Logins stored in an older format are upgraded once the vault is open.
+// The vault must have its Name and Storage set.
+func unlockVault(vault *kittypass.Vault) error {
+	return openVault(vault, true)
+}
+
+// unlockVaultWithPassword is unlockVault without the agent, for commands that need the master password itself.
+func unlockVaultWithPassword(vault *kittypass.Vault) error {
+	return openVault(vault, false)
+}
+
+func openVault(vault *kittypass.Vault, useAgent bool) error {
+	err := vault.Get()
+	if err != nil {
+		return err
+	}
+
+	fromAgent := useAgent && unlockWithAgent(vault)
+	if !fromAgent {
+		vault.Masterpass, err = masterSecret.read("Input master password:")
+		if err != nil {
+			return err
+		}
+		if vault.Masterpass == "" {
+			return errors.New("invalid empty master password")
+		}
+	}
+
+	s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
+	s.Color("green")
+	s.Prefix = "Checking Master Password"
+	s.Start()
+
+	if !fromAgent {
+		if err := vault.Unlock(); err != nil {
+			var incorrect kittypass.IncorrectPasswordError
+			if errors.As(err, &incorrect) {
+				s.FinalMSG = red("Master Password check failed.\n")
+			} else {
+				s.FinalMSG = red("Opening Vault failed.\n")
+			}
+			s.Stop()
+			return err
+		}
+	}
+	upgraded, err := vault.UpgradeLogins()
+	if err != nil {
+		s.FinalMSG = red("Upgrading Vault logins failed.\n")
+		s.Stop()
+		return err
+	}
+	if fromAgent {
+		s.FinalMSG = green("✓ Successfully opened Vault with the key held by the agent.\n")
+	} else {
+		s.FinalMSG = green("✓ Successfully opened Vault.\n")
+	}
+	s.Stop()
+	if upgraded > 0 {
+		fmt.Printf("%s%s%s\n", green("✓ Upgraded "), blue(upgraded), green(" Logins to the current encryption format."))
+	}
+	return nil
+}
+
+// unlockWithAgent unlocks the vault with the key held by the agent and reports whether it could.
+// Failures are only logged: the master password is asked for instead.
+func unlockWithAgent(vault *kittypass.Vault) bool {
+	client := agent.NewClient(conf.AgentSocket)
+	key, err := client.Get(vault.Uuid)
+	if err != nil {
+		var notRunning agent.NotRunningError
+		var notFound agent.KeyNotFoundError
+		if !errors.As(err, &notRunning) && !errors.As(err, &notFound) {
+			log.Printf("failed to get the key of vault %s from the agent: %s", vault.Name, err)
+		}
+		return false
+	}
+	if err := vault.UnlockWithKey(key); err != nil {
+		log.Printf("key held by the agent failed to unlock vault %s, forgetting it: %s", vault.Name, err)
+		forgetInAgent(vault.Uuid)
+		return false
+	}
+	return true
+}
+
+// forgetInAgent makes the agent forget the key of a vault, once it no longer unlocks the vault or the vault is gone.
+func forgetInAgent(vaultUuid string) {
+	_, err := agent.NewClient(conf.AgentSocket).Lock(vaultUuid)
+	var notRunning agent.NotRunningError
+	if err != nil && !errors.As(err, &notRunning) {
+		log.Printf("failed to remove the key of vault %s from the agent: %s", vaultUuid, err)
+	}
+}
@@ -3,12 +3,11 @@ package cli
 import (
 	"errors"
 	"fmt"
-	"strings"
+	"os"
 	"time"
 
 	"github.com/briandowns/spinner"
 	"github.com/mrtnhwtt/kittypass/internal/kittypass"
-	"github.com/mrtnhwtt/kittypass/internal/prompt"
 	"github.com/spf13/cobra"
 )
 
@@ -35,7 +34,9 @@ func NewUpdateLoginCmd() *cobra.Command {
 	login := kittypass.NewLogin()
 	vault := kittypass.NewVault()
 	login.Vault = &vault
-	var targetName string
+	var targetName, policyName string
+	var force bool
+	var loginSecret *secretSource
 
 	cmd := &cobra.Command{
 		Use:     "login",
@@ -51,47 +52,76 @@ func NewUpdateLoginCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
-			s.Color("green")
-			s.Prefix = "Checking Master Password"
-
-			login.Vault.Masterpass = strings.TrimSpace(prompt.PasswordPrompt("Input master password:"))
-			if login.Vault.Masterpass == "" {
-				return errors.New("invalid empty master password")
+			generatePassword = generatePassword || login.Generator.Passphrase
+			// reading the password from standard input or a file implies --password
+			setPassword = setPassword || !loginSecret.prompted()
+			if setPassword {
+				if generatePassword {
+					return errors.New("a provided password cannot be combined with a generated password")
+				}
+				loginSecret.useDefaultFile(conf.LoginPasswordFile)
 			}
-
-			s.Start()
-			err = login.Vault.Get()
-			if err != nil {
-				s.FinalMSG = red("Master Password check failed.\n")
-				s.Stop()
-				return err
+			if policyName != "" && generatorFlagsChanged(cmd) {
+				return errors.New("password generator options cannot be combined with --policy")
 			}
-			if err = login.Vault.MasterpassMatch(); err != nil {
-				s.FinalMSG = red("Master Password check failed.\n")
-				s.Stop()
+			if generatePassword && policyName == "" {
+				if err := login.Generator.Validate(); err != nil {
+					return err
+				}
+			}
+			db, err := openStorage()
+			if err != nil {
 				return err
 			}
-			err = login.Vault.RecreateDerivationKey()
+			defer db.Close()
+			login.Vault.Storage = db
+
+			err = unlockVault(login.Vault)
 			if err != nil {
-				s.FinalMSG = red("Opening Vault failed.\n")
-				s.Stop()
 				return err
 			}
-			s.FinalMSG = green("✓ Successfully opened Vault.\n")
-			s.Stop()
+			// without generator options, a login keeps generating passwords with its saved policy
+			if policyName == "" && generatePassword && !generatorFlagsChanged(cmd) {
+				policyName, err = login.SavedPolicy(targetName)
+				if err != nil {
+					return err
+				}
+			}
+			if policyName != "" {
+				if err := login.UsePolicy(policyName); err != nil {
+					return err
+				}
+				if generatePassword {
+					fmt.Printf("%s %s\n", green("Generating password with policy"), blue(policyName))
+				}
+			}
 			if setPassword {
-				login.Password = strings.TrimSpace(prompt.PasswordPrompt("Input new password:"))
+				login.Password, err = loginSecret.read("Input new password:")
+				if err != nil {
+					return err
+				}
 				if login.Password == "" {
 					return errors.New("invalid empty password")
 				}
-				confirm := strings.TrimSpace(prompt.PasswordPrompt("Confirm new password:"))
-				if login.Password != confirm {
-					return errors.New("password does not match")
+				if err := checkStrength(login.Password, force, targetName, login.Name, login.Username, login.Vault.Name); err != nil {
+					return err
+				}
+				if loginSecret.prompted() {
+					confirm, err := loginSecret.read("Confirm new password:")
+					if err != nil {
+						return err
+					}
+					if login.Password != confirm {
+						return errors.New("password does not match")
+					}
 				}
 			}
 			if generatePassword {
-				login.Password = login.Generator.GeneratePassword()
+				login.Password, err = login.Generator.GeneratePassword()
+				if err != nil {
+					return err
+				}
+				printEntropy(os.Stdout, &login.Generator)
 			}
 
 			err = login.Vault.Get()
@@ -116,16 +146,17 @@ func NewUpdateLoginCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&login.Username, "new-username", "u", "", "New Username or email for the login")
 	cmd.Flags().StringVarP(&login.Vault.Name, "vault", "v", "", "vault of the target login")
 	cmd.Flags().BoolP("password", "p", false, "prompt to set a user provided new password for the login")
+	loginSecret = newLoginSecret(cmd)
+	cmd.Flags().BoolVar(&force, "force", false, "Accept a password below the minimum strength score")
 	cmd.Flags().BoolP("generate", "g", false, "Generate a new password")
-	cmd.Flags().IntVarP(&login.Generator.Length, "lenght", "l", 16, "Length of the generated password")
-	cmd.Flags().BoolVarP(&login.Generator.SpecialChar, "special-char", "s", false, "Use special character in the password")
-	cmd.Flags().BoolVarP(&login.Generator.Numeral, "numeral", "N", false, "Add number in the password")
-	cmd.Flags().BoolVarP(&login.Generator.Uppercase, "uppercase", "U", false, "Use uppercase and lowercase characters")
+	registerGeneratorFlags(cmd, &login.Generator)
+	cmd.Flags().StringVar(&policyName, "policy", "", "Name of the password policy generating the passwords of the login, saved on the login")
 
 	cmd.MarkFlagsMutuallyExclusive("password", "generate")
+	cmd.MarkFlagsMutuallyExclusive("password", "passphrase")
 	cmd.MarkFlagRequired("target")
 	cmd.MarkFlagRequired("vault")
-	cmd.MarkFlagsOneRequired("password", "new-name", "new-username", "generate")
+	cmd.MarkFlagsOneRequired("password", "login-password-stdin", "login-password-file", "new-name", "new-username", "generate", "passphrase", "policy")
 
 	return cmd
 }
@@ -133,14 +164,21 @@ func NewUpdateLoginCmd() *cobra.Command {
 func NewUpdateVaultCmd() *cobra.Command {
 	vault := kittypass.NewVault()
 	var newName, newDescription, newPassword string
-	var setNewPass bool
+	var setNewPass, force bool
 	cmd := &cobra.Command{
 		Use:     "vault",
 		Aliases: []string{"folder"},
 		Short:   "update a vault",
 		Long:    "update a vault name, description or master password",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			err := vault.Get()
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			vault.Storage = db
+
+			err = vault.Get()
 			if err != nil {
 				return err
 			}
@@ -148,33 +186,45 @@ func NewUpdateVaultCmd() *cobra.Command {
 			s.Color("green")
 			s.Prefix = "Checking Master Password"
 
-			vault.Masterpass = strings.TrimSpace(prompt.PasswordPrompt("Input master password:"))
+			vault.Masterpass, err = masterSecret.read("Input master password:")
+			if err != nil {
+				return err
+			}
 			if vault.Masterpass == "" {
 				return errors.New("invalid empty master password")
 			}
 
 			s.Start()
-			if match := vault.MasterpassMatch(); match != nil {
+			if match := vault.Unlock(); match != nil {
 				s.FinalMSG = red("Master Password check failed.\n")
 				s.Stop()
-				return fmt.Errorf("failed master password check: %s", match.Error())
+				return fmt.Errorf("failed master password check: %w", match)
 			}
 			s.FinalMSG = green("✓ Successfully opened Vault.\n")
 			s.Stop()
 
 			if setNewPass {
-				newPassword = strings.TrimSpace(prompt.PasswordPrompt("Input new master password:"))
+				// the new master password follows the current one on standard input, it is never read from the master password file
+				newSecret := secretSource{stdin: masterSecret.stdin, name: "new master password", flag: "password"}
+				newPassword, err = newSecret.read("Input new master password:")
+				if err != nil {
+					return err
+				}
 				if newPassword == "" {
 					return errors.New("invalid empty master password")
 				}
-				confirm := strings.TrimSpace(prompt.PasswordPrompt("Confirm new master password:"))
-				if newPassword != confirm {
-					return errors.New("master password does not match")
-				}
-				err = vault.RecreateDerivationKey()
-				if err != nil {
+				if err := checkStrength(newPassword, force, vault.Name, newName); err != nil {
 					return err
 				}
+				if newSecret.prompted() {
+					confirm, err := newSecret.read("Confirm new master password:")
+					if err != nil {
+						return err
+					}
+					if newPassword != confirm {
+						return errors.New("master password does not match")
+					}
+				}
 			}
 
 			s = spinner.New(spinner.CharSets[26], 150*time.Millisecond)
@@ -184,16 +234,21 @@ func NewUpdateVaultCmd() *cobra.Command {
 
 			affected, err := vault.Update(newPassword, newName, newDescription)
 			s.Stop()
+			if err != nil {
+				return err
+			}
+			if newPassword != "" {
+				forgetInAgent(vault.Uuid)
+			}
 			fmt.Printf("%s%s%s\n", green("✓ Successfully updated "), blue(affected["updated_vault"]), green(" Vault."))
-			fmt.Printf("%s%s%s\n", green("✓ Successfully updated "), blue(affected["updated_login"]), green(" Logins."))
-			return err
-			// return nil
+			return nil
 		},
 	}
 	cmd.Flags().StringVarP(&vault.Name, "target", "t", "", "Name of the vault to update")
 	cmd.Flags().StringVarP(&newName, "new-name", "n", "", "New name for the vault")
 	cmd.Flags().StringVarP(&newDescription, "new-description", "d", "", "New description for the vault")
 	cmd.Flags().BoolVarP(&setNewPass, "new-password", "p", false, "prompt to set a new master password")
+	cmd.Flags().BoolVar(&force, "force", false, "Accept a master password below the minimum strength score")
 	cmd.MarkFlagRequired("target")
 	cmd.MarkFlagsOneRequired("new-name", "new-description", "new-password")
 	return cmd
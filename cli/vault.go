@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/mrtnhwtt/kittypass/internal/crypto"
+	"github.com/mrtnhwtt/kittypass/internal/kittypass"
+	"github.com/spf13/cobra"
+)
+
+func NewVaultCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "vault",
+		Aliases: []string{"folder"},
+		Short:   "manage the security settings of a vault",
+		Long:    "manage the security settings of a vault",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	cmd.AddCommand(
+		NewVaultUpgradeKDFCmd(),
+	)
+	return cmd
+}
+
+func NewVaultUpgradeKDFCmd() *cobra.Command {
+	vault := kittypass.NewVault()
+	var kdf kdfFlags
+
+	cmd := &cobra.Command{
+		Use:   "upgrade-kdf",
+		Short: "Strengthen the key derivation of a Vault.",
+		Long: "Derive the key of a Vault from its master password with stronger Argon2id parameters. " +
+			"Parameters that are not given keep their current value. Requires the master password.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openStorage()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			vault.Storage = db
+
+			err = unlockVaultWithPassword(&vault)
+			if err != nil {
+				return err
+			}
+			params, err := kdf.params(cmd, vault.KDF)
+			if err != nil {
+				return err
+			}
+
+			s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
+			s.Color("green")
+			s.Prefix = "Upgrading Vault key derivation"
+			s.Start()
+
+			current := vault.KDF
+			err = vault.UpgradeKDF(params)
+			if err != nil {
+				s.FinalMSG = red("Upgrading Vault key derivation failed.\n")
+				s.Stop()
+				return err
+			}
+			forgetInAgent(vault.Uuid)
+			s.FinalMSG = fmt.Sprintf("%s %s %s %s\n", green("✓ Upgraded key derivation from"), blue(current), green("to"), blue(vault.KDF))
+			s.Stop()
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&vault.Name, "name", "n", "", "Name of the Vault")
+	kdf.register(cmd)
+	cmd.MarkFlagRequired("name")
+	cmd.MarkFlagsOneRequired("kdf-time", "kdf-memory", "kdf-parallelism", "calibrate")
+	return cmd
+}
+
+// kdfFlags are the flags choosing the Argon2id parameters of a vault.
+type kdfFlags struct {
+	time      uint32
+	memory    uint32
+	threads   uint8
+	calibrate time.Duration
+}
+
+func (f *kdfFlags) register(cmd *cobra.Command) {
+	cmd.Flags().Uint32Var(&f.time, "kdf-time", crypto.DefaultKDFParams.Time, "Argon2id number of passes")
+	cmd.Flags().Uint32Var(&f.memory, "kdf-memory", crypto.DefaultKDFParams.Memory/1024, "Argon2id memory in MiB")
+	cmd.Flags().Uint8Var(&f.threads, "kdf-parallelism", crypto.DefaultKDFParams.Threads, "Argon2id parallelism")
+	cmd.Flags().DurationVar(&f.calibrate, "calibrate", 0, "Pick the Argon2id time and memory taking this long to unlock the Vault on this machine, e.g. 1s")
+	cmd.MarkFlagsMutuallyExclusive("calibrate", "kdf-time")
+	cmd.MarkFlagsMutuallyExclusive("calibrate", "kdf-memory")
+}
+
+// params returns the parameters chosen by the flags. Parameters whose flag was not set keep their value in current.
+func (f *kdfFlags) params(cmd *cobra.Command, current crypto.KDFParams) (crypto.KDFParams, error) {
+	params := current
+	if cmd.Flags().Changed("kdf-parallelism") {
+		params.Threads = f.threads
+	}
+	if cmd.Flags().Changed("calibrate") && f.calibrate <= 0 {
+		return crypto.KDFParams{}, crypto.InvalidKDFParamsError{Message: fmt.Sprintf("calibration time must be above 0, got %s", f.calibrate)}
+	}
+	if f.calibrate > 0 {
+		s := spinner.New(spinner.CharSets[26], 150*time.Millisecond)
+		s.Color("green")
+		s.Prefix = "Calibrating key derivation"
+		s.Start()
+		params = crypto.Calibrate(f.calibrate, params)
+		s.FinalMSG = fmt.Sprintf("%s %s\n", green("✓ Calibrated key derivation:"), blue(params))
+		s.Stop()
+		return params, nil
+	}
+	if cmd.Flags().Changed("kdf-time") {
+		params.Time = f.time
+	}
+	if cmd.Flags().Changed("kdf-memory") {
+		// the memory is given in MiB and stored in KiB
+		if f.memory > math.MaxUint32/1024 {
+			return crypto.KDFParams{}, crypto.InvalidKDFParamsError{Message: fmt.Sprintf("memory of %d MiB is above the maximum of %d MiB", f.memory, math.MaxUint32/1024)}
+		}
+		params.Memory = f.memory * 1024
+	}
+	return params, nil
+}
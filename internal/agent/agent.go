@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The agent keeps the derivation keys of unlocked vaults in memory, so that commands do not ask for the master password
+// and derive the key again every time. It listens on a Unix socket only its user can open, and checks the user of every
+// connection. Each connection carries a single request and its response, as JSON.
+
+const (
+	opPing = "ping"
+	opGet  = "get"
+	opAdd  = "add"
+	opLock = "lock"
+	opStop = "stop"
+)
+
+type request struct {
+	Op    string `json:"op"`
+	Vault string `json:"vault,omitempty"`
+	Key   []byte `json:"key,omitempty"`
+}
+
+type response struct {
+	Key   []byte `json:"key,omitempty"`
+	Count int    `json:"count,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ioTimeout bounds how long a connection can take to send its request or read its response.
+const ioTimeout = 5 * time.Second
+
+type entry struct {
+	key   []byte
+	timer *time.Timer
+}
+
+// Server is a running agent.
+type Server struct {
+	listener net.Listener
+	path     string
+	timeout  time.Duration
+	mu       sync.Mutex
+	keys     map[string]*entry
+	stopping chan struct{}
+	stopOnce sync.Once
+}
+
+// Listen creates the socket of the agent at path. Keys not used for timeout are forgotten, timeout 0 keeps them until they are locked.
+// A socket left behind by an agent that is gone is replaced, a running agent is not.
+func Listen(path string, timeout time.Duration) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, SocketError{Path: path, Err: err}
+	}
+	if err := NewClient(path).Ping(); err == nil {
+		return nil, AlreadyRunningError{Path: path}
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, SocketError{Path: path, Err: err}
+	}
+
+	// the socket is created without any permission for the group and others, and is never reachable by them
+	mask := umask(0177)
+	listener, err := net.Listen("unix", path)
+	umask(mask)
+	if err != nil {
+		return nil, SocketError{Path: path, Err: err}
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, SocketError{Path: path, Err: err}
+	}
+	return &Server{
+		listener: listener,
+		path:     path,
+		timeout:  timeout,
+		keys:     map[string]*entry{},
+		stopping: make(chan struct{}),
+	}, nil
+}
+
+// Serve answers requests until the agent is stopped. Every key is wiped from memory before it returns.
+func (s *Server) Serve() error {
+	defer s.lockAll()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.stopping:
+				return nil
+			default:
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		go s.handle(conn.(*net.UnixConn))
+	}
+}
+
+// Stop closes the socket of the agent, ending Serve.
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopping)
+		s.listener.Close()
+	})
+}
+
+func (s *Server) handle(conn *net.UnixConn) {
+	defer conn.Close()
+	uid, err := peerUID(conn)
+	if err != nil {
+		log.Printf("agent refused a connection, could not read the peer credentials: %s", err)
+		return
+	}
+	if uid != os.Getuid() {
+		log.Printf("agent refused a connection from user %d", uid)
+		return
+	}
+
+	conn.SetDeadline(time.Now().Add(ioTimeout))
+	var req request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		log.Printf("agent received a malformed request: %s", err)
+		return
+	}
+	resp := s.answer(req)
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		log.Printf("agent failed to send its response: %s", err)
+	}
+	wipe(req.Key)
+	wipe(resp.Key)
+	if req.Op == opStop {
+		s.Stop()
+	}
+}
+
+func (s *Server) answer(req request) response {
+	switch req.Op {
+	case opPing, opStop:
+		return response{}
+	case opGet:
+		key, found := s.get(req.Vault)
+		if !found {
+			return response{Error: KeyNotFoundError{}.Error()}
+		}
+		return response{Key: key}
+	case opAdd:
+		if req.Vault == "" || len(req.Key) == 0 {
+			return response{Error: "missing vault or key"}
+		}
+		s.add(req.Vault, req.Key)
+		return response{}
+	case opLock:
+		if req.Vault == "" {
+			return response{Count: s.lockAll()}
+		}
+		return response{Count: s.lock(req.Vault)}
+	}
+	return response{Error: "unknown operation " + req.Op}
+}
+
+// get returns a copy of the key of a vault and restarts its idle timeout.
+func (s *Server) get(vault string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, found := s.keys[vault]
+	if !found {
+		return nil, false
+	}
+	if e.timer != nil {
+		e.timer.Reset(s.timeout)
+	}
+	return append([]byte(nil), e.key...), true
+}
+
+func (s *Server) add(vault string, key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(vault)
+	e := &entry{key: append([]byte(nil), key...)}
+	if s.timeout > 0 {
+		e.timer = time.AfterFunc(s.timeout, func() { s.expire(vault, e) })
+	}
+	s.keys[vault] = e
+}
+
+// expire forgets the key of a vault once its idle timeout is over, unless it was replaced meanwhile.
+func (s *Server) expire(vault string, e *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys[vault] == e {
+		s.remove(vault)
+		log.Printf("agent forgot the key of vault %s after %s without use", vault, s.timeout)
+	}
+}
+
+func (s *Server) lock(vault string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remove(vault)
+}
+
+func (s *Server) lockAll() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for vault := range s.keys {
+		count += s.remove(vault)
+	}
+	return count
+}
+
+// remove wipes the key of a vault and forgets it. The caller must hold the mutex.
+func (s *Server) remove(vault string) int {
+	e, found := s.keys[vault]
+	if !found {
+		return 0
+	}
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	wipe(e.key)
+	delete(s.keys, vault)
+	return 1
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
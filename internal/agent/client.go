@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Client sends requests to the agent listening on a socket.
+type Client struct {
+	path string
+}
+
+func NewClient(path string) Client {
+	return Client{path: path}
+}
+
+// Ping checks that the agent is running.
+func (c Client) Ping() error {
+	_, err := c.send(request{Op: opPing})
+	return err
+}
+
+// Get returns the derivation key the agent holds for a vault, or KeyNotFoundError when the vault is not unlocked.
+func (c Client) Get(vaultUuid string) ([]byte, error) {
+	resp, err := c.send(request{Op: opGet, Vault: vaultUuid})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Key, nil
+}
+
+// Add hands the derivation key of a vault over to the agent.
+func (c Client) Add(vaultUuid string, key []byte) error {
+	_, err := c.send(request{Op: opAdd, Vault: vaultUuid, Key: key})
+	return err
+}
+
+// Lock makes the agent forget the key of a vault, or of every vault when vaultUuid is empty, and returns how many keys it forgot.
+func (c Client) Lock(vaultUuid string) (int, error) {
+	resp, err := c.send(request{Op: opLock, Vault: vaultUuid})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+// Stop makes the agent forget every key and exit.
+func (c Client) Stop() error {
+	_, err := c.send(request{Op: opStop})
+	return err
+}
+
+func (c Client) send(req request) (response, error) {
+	conn, err := net.DialTimeout("unix", c.path, ioTimeout)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+			return response{}, NotRunningError{Path: c.path}
+		}
+		return response{}, SocketError{Path: c.path, Err: err}
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ioTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return response{}, SocketError{Path: c.path, Err: err}
+	}
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return response{}, SocketError{Path: c.path, Err: err}
+	}
+	if resp.Error == (KeyNotFoundError{}).Error() {
+		return response{}, KeyNotFoundError{}
+	}
+	if resp.Error != "" {
+		return response{}, RequestError{Message: resp.Error}
+	}
+	return resp, nil
+}
@@ -0,0 +1,48 @@
+package agent
+
+import "fmt"
+
+type NotRunningError struct {
+	Path string
+}
+
+func (e NotRunningError) Error() string {
+	return fmt.Sprintf("no agent is listening on %s, start it with kittypass agent", e.Path)
+}
+
+type AlreadyRunningError struct {
+	Path string
+}
+
+func (e AlreadyRunningError) Error() string {
+	return fmt.Sprintf("an agent is already listening on %s", e.Path)
+}
+
+type SocketError struct {
+	Path string
+	Err  error
+}
+
+func (e SocketError) Error() string {
+	return fmt.Sprintf("failed to use agent socket %s: %s", e.Path, e.Err)
+}
+
+type KeyNotFoundError struct{}
+
+func (e KeyNotFoundError) Error() string {
+	return "vault is not unlocked in the agent"
+}
+
+type RequestError struct {
+	Message string
+}
+
+func (e RequestError) Error() string {
+	return fmt.Sprintf("agent refused the request: %s", e.Message)
+}
+
+type UnsupportedPlatformError struct{}
+
+func (e UnsupportedPlatformError) Error() string {
+	return "the agent is not supported on this platform"
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package agent
+
+import "net"
+
+// peerUID refuses every connection on platforms where the user of a peer cannot be checked.
+func peerUID(conn *net.UnixConn) (int, error) {
+	return 0, UnsupportedPlatformError{}
+}
+
+func umask(mask int) int {
+	return mask
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Config holds the settings of kittypass once resolved from flags, environment variables, the config file and defaults, in that order of precedence.
+type Config struct {
+	// Database is the location of the store holding vaults and logins.
+	Database string
+	// MovedDatabase is the current default location of the database. It is only set when no location is configured,
+	// nothing exists there yet and a database is found at LegacyDatabase, the default of earlier versions, which Database is then set to.
+	MovedDatabase string
+	// LogFile is the file kittypass appends its logs to.
+	LogFile string
+	// MinPasswordScore is the lowest strength score, from 0 to 4, accepted for passwords typed by the user.
+	MinPasswordScore int
+	// HIBPFile is the Have I Been Pwned password list, ordered by hash, that passwords typed by the user are checked against.
+	// Passwords are not checked when it is empty.
+	HIBPFile string
+	// AgentSocket is the Unix socket the agent holding unlocked vault keys listens on.
+	AgentSocket string
+	// AgentTimeout is how long the agent keeps the key of a vault that is not used, 0 to keep it until the vault is locked.
+	AgentTimeout time.Duration
+	// ClipboardTimeout is how long a password copied to the clipboard stays there, 0 to leave it.
+	ClipboardTimeout time.Duration
+	// MasterPasswordFile holds the master password of vaults, read instead of prompting for it when set.
+	MasterPasswordFile string
+	// LoginPasswordFile holds the password of the login added or updated, read instead of prompting for it when set.
+	LoginPasswordFile string
+}
+
+// LegacyDatabase is the default location of the database before it moved under DataDir, relative to the working directory.
+const LegacyDatabase = "database.db"
+
+// Load resolves the configuration. Values are looked up in the flags bound from the given flag set,
+// then in KITTYPASS_* environment variables, then in the config file found under ConfigDir, and finally fall back to defaults under DataDir.
+func Load(flags *pflag.FlagSet) (Config, error) {
+	dataDir, err := DataDir()
+	if err != nil {
+		return Config{}, err
+	}
+	configDir, err := ConfigDir()
+	if err != nil {
+		return Config{}, err
+	}
+	runtimeDir, err := RuntimeDir()
+	if err != nil {
+		return Config{}, err
+	}
+
+	v := viper.New()
+	v.SetDefault("log", filepath.Join(dataDir, "kittypass.log"))
+	v.SetDefault("min_password_score", 3)
+	v.SetDefault("agent_socket", filepath.Join(runtimeDir, "agent.sock"))
+	v.SetDefault("agent_timeout", 15*time.Minute)
+	v.SetDefault("clipboard_timeout", 30*time.Second)
+
+	v.SetEnvPrefix("kittypass")
+	v.AutomaticEnv()
+
+	v.SetConfigName("config")
+	v.AddConfigPath(configDir)
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return Config{}, ConfigFileError{Err: err}
+		}
+	}
+
+	if flag := flags.Lookup("db"); flag != nil {
+		if err := v.BindPFlag("db", flag); err != nil {
+			return Config{}, err
+		}
+	}
+
+	minScore := v.GetInt("min_password_score")
+	if minScore < 0 || minScore > 4 {
+		return Config{}, InvalidSettingError{Key: "min_password_score", Message: "must be between 0 and 4"}
+	}
+
+	agentTimeout := v.GetDuration("agent_timeout")
+	if agentTimeout < 0 {
+		return Config{}, InvalidSettingError{Key: "agent_timeout", Message: "must not be negative"}
+	}
+	clipboardTimeout := v.GetDuration("clipboard_timeout")
+	if clipboardTimeout < 0 {
+		return Config{}, InvalidSettingError{Key: "clipboard_timeout", Message: "must not be negative"}
+	}
+
+	database, movedDatabase := v.GetString("db"), ""
+	if database == "" {
+		database, movedDatabase = defaultDatabase(dataDir)
+	}
+
+	return Config{
+		Database:           database,
+		MovedDatabase:      movedDatabase,
+		LogFile:            v.GetString("log"),
+		MinPasswordScore:   minScore,
+		HIBPFile:           v.GetString("hibp_file"),
+		AgentSocket:        v.GetString("agent_socket"),
+		AgentTimeout:       agentTimeout,
+		ClipboardTimeout:   clipboardTimeout,
+		MasterPasswordFile: v.GetString("master_password_file"),
+		LoginPasswordFile:  v.GetString("login_password_file"),
+	}, nil
+}
+
+// defaultDatabase returns the database used when no location is configured: kittypass.db under dataDir, unless it does not
+// exist yet while a database is left at LegacyDatabase. The legacy database is then returned, along with the current default.
+func defaultDatabase(dataDir string) (string, string) {
+	database := filepath.Join(dataDir, "kittypass.db")
+	if _, err := os.Stat(database); !errors.Is(err, os.ErrNotExist) {
+		return database, ""
+	}
+	if info, err := os.Stat(LegacyDatabase); err == nil && info.Mode().IsRegular() {
+		return LegacyDatabase, database
+	}
+	return database, ""
+}
+
+// ConfigDir returns the directory holding the kittypass config file: $XDG_CONFIG_HOME/kittypass, or ~/.config/kittypass when XDG_CONFIG_HOME is not set.
+func ConfigDir() (string, error) {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// DataDir returns the directory holding the kittypass data: $XDG_DATA_HOME/kittypass, or ~/.local/share/kittypass when XDG_DATA_HOME is not set.
+func DataDir() (string, error) {
+	return xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+// RuntimeDir returns the directory holding the agent socket: $XDG_RUNTIME_DIR/kittypass, or a kittypass-<uid> directory
+// in the temporary directory when XDG_RUNTIME_DIR is not set.
+func RuntimeDir() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "kittypass"), nil
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("kittypass-%d", os.Getuid())), nil
+}
+
+func xdgDir(env, fallback string) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "kittypass"), nil
+	}
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homedir, fallback, "kittypass"), nil
+}
@@ -0,0 +1,20 @@
+package config
+
+import "fmt"
+
+type ConfigFileError struct {
+	Err error
+}
+
+func (e ConfigFileError) Error() string {
+	return fmt.Sprintf("failed to read config file: %s", e.Err)
+}
+
+type InvalidSettingError struct {
+	Key     string
+	Message string
+}
+
+func (e InvalidSettingError) Error() string {
+	return fmt.Sprintf("invalid setting %s: %s", e.Key, e.Message)
+}
@@ -4,20 +4,40 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"encoding/hex"
+	"crypto/sha256"
+	"fmt"
 	"io"
 	"log"
 
-	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
 )
 
+// Names of the supported encryption algorithms, as stored with each vault.
+const (
+	AES               = "aes"
+	XChaCha20Poly1305 = "xchacha20-poly1305"
+)
+
+// Encryption is an authenticated encryption algorithm. Use Encrypt and Decrypt to produce and read self-describing envelopes.
 type Encryption interface {
-	Encrypt(masterKey []byte, plainText string) (string, error)
-	Decrypt(masterKey []byte, cipherText string) (string, error)
+	// ID identifies the algorithm in envelopes.
+	ID() byte
+	NonceSize() int
+	// Seal encrypts plainText and authenticates it along with additionalData, which is not encrypted.
+	Seal(key, nonce, plainText, additionalData []byte) ([]byte, error)
+	// Open decrypts cipherText, failing if it or additionalData differ from what was sealed.
+	Open(key, nonce, cipherText, additionalData []byte) ([]byte, error)
 }
 
-func GenerateKey(password, salt []byte) []byte {
-	return argon2.IDKey(password, salt, 1, 64*1024, 4, 32)
+// DeriveSubkey derives a 32 bytes key from key using HKDF-SHA256 with the given salt and context info.
+// It is used to give every login its own encryption key derived from the vault key.
+func DeriveSubkey(key, salt []byte, info string) ([]byte, error) {
+	subkey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, []byte(info)), subkey); err != nil {
+		log.Printf("failed to derive subkey: %s", err)
+		return nil, GenEncryptionKeyError{Message: "error while deriving subkey"}
+	}
+	return subkey, nil
 }
 
 func GenerateRandomSalt(saltSize int) ([]byte, error) {
@@ -30,72 +50,138 @@ func GenerateRandomSalt(saltSize int) ([]byte, error) {
 	return salt, nil
 }
 
-func New(t string) Encryption {
+// GenerateRandomKey returns a new random 32 bytes key.
+func GenerateRandomKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Printf("error while generating random key: %s", err)
+		return nil, GenEncryptionKeyError{Message: "error while generating random key"}
+	}
+	return key, nil
+}
+
+// New returns the implementation of the encryption algorithm named t.
+func New(t string) (Encryption, error) {
 	switch t {
-	case "aes":
-		return Aes{}
+	case AES:
+		return Aes{}, nil
+	case XChaCha20Poly1305:
+		return XChaCha20{}, nil
 	default:
-		return Aes{}
+		return nil, UnsupportedAlgorithmError{Algorithm: t}
 	}
-
 }
 
-type Aes struct{}
+// byID returns the implementation of the encryption algorithm identified by id in an envelope.
+func byID(id byte) (Encryption, error) {
+	switch id {
+	case Aes{}.ID():
+		return Aes{}, nil
+	case XChaCha20{}.ID():
+		return XChaCha20{}, nil
+	default:
+		return nil, UnsupportedAlgorithmError{Algorithm: fmt.Sprintf("id %d", id)}
+	}
+}
 
-func (a Aes) Encrypt(masterKey []byte, plainText string) (string, error) {
-	cb, err := aes.NewCipher(masterKey)
-	if err != nil {
-		if _, ok := err.(aes.KeySizeError); ok {
-			log.Printf("encryption function received invalid encryption key length of %d, expect 32", len(masterKey))
-			return "", EncryptionKeyError{Message: "invalid encryption key length"}
-		}
-		log.Printf("failed to generate cipher block for encryption: %s", err)
+// Encrypt encrypts plainText with e under a random nonce and returns it as an envelope recording the algorithm and kdf, the way key was derived.
+// additionalData binds the ciphertext to its context, such as the login it belongs to: it must be given again to Decrypt.
+func Encrypt(e Encryption, kdf KDF, key []byte, plainText string, additionalData []byte) (string, error) {
+	nonce := make([]byte, e.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		log.Printf("failed to fill nonce: %s", err)
 		return "", EncryptionError{}
 	}
-
-	gcm, err := cipher.NewGCM(cb)
+	cipherText, err := e.Seal(key, nonce, []byte(plainText), additionalData)
 	if err != nil {
-		log.Printf("failed to generate encryption algorithm from cipher block: %s", err)
-		return "", EncryptionError{}
+		return "", err
 	}
+	envelope := Envelope{
+		Version:    EnvelopeVersion,
+		Algorithm:  e.ID(),
+		KDF:        kdf,
+		Nonce:      nonce,
+		CipherText: cipherText,
+	}
+	return envelope.Encode(), nil
+}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		log.Printf("failed to fill nonce: %s", err)
-		return "", EncryptionError{}
+// Decrypt decrypts cipherText with the algorithm recorded in its envelope, checking it against the additionalData given to Encrypt.
+// Ciphertexts written before envelopes existed hold no algorithm and are decrypted with legacy.
+// Ciphertexts written before additional data was authenticated are decrypted without it, unless minVersion refuses them:
+// ciphertexts in an envelope version below minVersion, legacy ones included, are never decrypted.
+func Decrypt(key []byte, cipherText string, additionalData []byte, legacy Encryption, minVersion byte) (string, error) {
+	envelope, err := ParseEnvelope(cipherText, legacy)
+	if err != nil {
+		return "", err
+	}
+	if envelope.Version < minVersion {
+		log.Printf("refusing ciphertext in envelope version %d, below the minimum version %d", envelope.Version, minVersion)
+		return "", OutdatedEnvelopeError{Version: envelope.Version, Minimum: minVersion}
 	}
+	e, err := byID(envelope.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	if envelope.Version < aadVersion {
+		additionalData = nil
+	}
+	out, err := e.Open(key, envelope.Nonce, envelope.CipherText, additionalData)
+	if err != nil {
+		if _, ok := err.(DecryptionError); ok && envelope.Version >= aadVersion {
+			return "", TamperedDataError{}
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+type Aes struct{}
 
-	cipherText := gcm.Seal(nonce, nonce, []byte(plainText), nil)
+func (a Aes) ID() byte {
+	return 1
+}
 
-	return hex.EncodeToString(cipherText), nil
+func (a Aes) NonceSize() int {
+	return 12
 }
 
-func (a Aes) Decrypt(masterKey []byte, cipherText string) (string, error) {
-	ct, err := hex.DecodeString(cipherText)
+func (a Aes) Seal(key, nonce, plainText, additionalData []byte) ([]byte, error) {
+	gcm, err := a.gcm(key)
 	if err != nil {
-		log.Printf("error when decoding stored hex password: %s", err)
-		return "", MalformedDataError{Data: "hex encrypted password"}
+		return nil, err
 	}
+	return gcm.Seal(nil, nonce, plainText, additionalData), nil
+}
 
-	cb, err := aes.NewCipher(masterKey)
+func (a Aes) Open(key, nonce, cipherText, additionalData []byte) ([]byte, error) {
+	gcm, err := a.gcm(key)
+	if err != nil {
+		return nil, err
+	}
+	out, err := gcm.Open(nil, nonce, cipherText, additionalData)
+	if err != nil {
+		log.Printf("failed to decrypt cipher text: %s", err)
+		return nil, DecryptionError{}
+	}
+	return out, nil
+}
+
+func (a Aes) gcm(key []byte) (cipher.AEAD, error) {
+	cb, err := aes.NewCipher(key)
 	if err != nil {
 		if _, ok := err.(aes.KeySizeError); ok {
-			log.Printf("encryption function received invalid encryption key length of %d, expect 32", len(masterKey))
-			return "", EncryptionKeyError{Message: "invalid encryption key length"}
+			log.Printf("encryption function received invalid encryption key length of %d, expect 32", len(key))
+			return nil, EncryptionKeyError{Message: "invalid encryption key length"}
 		}
 		log.Printf("failed to generate cipher block for encryption: %s", err)
-		return "", EncryptionError{}
-	}
-	gcm, err := cipher.NewGCM(cb)
-	if err != nil {
-		log.Printf("failed to generate nonce generator: %s", err)
-		return "", DecryptionError{}
+		return nil, EncryptionError{}
 	}
 
-	out, err := gcm.Open(nil, ct[:gcm.NonceSize()], ct[gcm.NonceSize():], nil)
+	gcm, err := cipher.NewGCM(cb)
 	if err != nil {
-		log.Printf("failed to decrypt cipher text: %s", err)
-		return "", DecryptionError{}
+		log.Printf("failed to generate encryption algorithm from cipher block: %s", err)
+		return nil, EncryptionError{}
 	}
-	return string(out), nil
+	return gcm, nil
 }
@@ -0,0 +1,108 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"log"
+	"strings"
+)
+
+// KDF identifies in an envelope how the encryption key was obtained. The parameters of the derivation are stored with the vault or the login.
+type KDF byte
+
+const (
+	// KDFArgon2id is the derivation key of a vault, derived from its master password with the Argon2id parameters of the vault.
+	KDFArgon2id KDF = 1
+	// KDFNone is a key used as is, such as the data key of a vault.
+	KDFNone KDF = 2
+	// KDFHKDFSHA256 is a login key, derived from the data key of its vault and the login salt with HKDF-SHA256.
+	KDFHKDFSHA256 KDF = 3
+)
+
+const (
+	// EnvelopeVersion is the version of the envelopes written by Encrypt.
+	EnvelopeVersion byte = 2
+	// aadVersion is the first envelope version whose ciphertext authenticates additional data.
+	aadVersion byte = 2
+	// legacyVersion is given to ciphertexts written before envelopes existed: bare hex encoded nonce and ciphertext.
+	legacyVersion byte = 0
+
+	// envelopePrefix marks envelopes. It cannot appear at the start of a legacy hex encoded ciphertext.
+	envelopePrefix = "kp"
+	headerSize     = 3
+)
+
+// Envelope is a ciphertext along with what is needed to decrypt it. It is encoded as "kp" followed by the hex encoding of
+// the version, algorithm and KDF bytes, the nonce, and the ciphertext with its authentication tag.
+type Envelope struct {
+	Version    byte
+	Algorithm  byte
+	KDF        KDF
+	Nonce      []byte
+	CipherText []byte
+}
+
+func (e Envelope) Encode() string {
+	raw := make([]byte, 0, headerSize+len(e.Nonce)+len(e.CipherText))
+	raw = append(raw, e.Version, e.Algorithm, byte(e.KDF))
+	raw = append(raw, e.Nonce...)
+	raw = append(raw, e.CipherText...)
+	return envelopePrefix + hex.EncodeToString(raw)
+}
+
+// IsEnvelope reports whether cipherText was written as an envelope rather than in the legacy format.
+func IsEnvelope(cipherText string) bool {
+	return strings.HasPrefix(cipherText, envelopePrefix)
+}
+
+// IsCurrent reports whether cipherText was written in the envelope version written by Encrypt.
+func IsCurrent(cipherText string) bool {
+	return strings.HasPrefix(cipherText, envelopePrefix+hex.EncodeToString([]byte{EnvelopeVersion}))
+}
+
+// ParseEnvelope decodes an envelope. A legacy ciphertext is returned as an envelope of version 0, its nonce split according to legacy.
+func ParseEnvelope(cipherText string, legacy Encryption) (Envelope, error) {
+	if !IsEnvelope(cipherText) {
+		raw, err := hex.DecodeString(cipherText)
+		if err != nil {
+			log.Printf("error when decoding stored hex password: %s", err)
+			return Envelope{}, MalformedDataError{Data: "hex encrypted password"}
+		}
+		if len(raw) < legacy.NonceSize() {
+			log.Printf("legacy cipher text of %d bytes is too short to hold a nonce", len(raw))
+			return Envelope{}, MalformedDataError{Data: "hex encrypted password"}
+		}
+		return Envelope{
+			Version:    legacyVersion,
+			Algorithm:  legacy.ID(),
+			Nonce:      raw[:legacy.NonceSize()],
+			CipherText: raw[legacy.NonceSize():],
+		}, nil
+	}
+
+	raw, err := hex.DecodeString(strings.TrimPrefix(cipherText, envelopePrefix))
+	if err != nil {
+		log.Printf("error when decoding envelope: %s", err)
+		return Envelope{}, MalformedDataError{Data: "envelope"}
+	}
+	if len(raw) < headerSize {
+		log.Printf("envelope of %d bytes is too short to hold a header", len(raw))
+		return Envelope{}, MalformedDataError{Data: "envelope"}
+	}
+	envelope := Envelope{Version: raw[0], Algorithm: raw[1], KDF: KDF(raw[2])}
+	if envelope.Version == legacyVersion || envelope.Version > EnvelopeVersion {
+		log.Printf("envelope has unsupported version %d", envelope.Version)
+		return Envelope{}, UnsupportedEnvelopeError{Version: envelope.Version}
+	}
+	e, err := byID(envelope.Algorithm)
+	if err != nil {
+		return Envelope{}, err
+	}
+	body := raw[headerSize:]
+	if len(body) < e.NonceSize() {
+		log.Printf("envelope body of %d bytes is too short to hold a nonce", len(body))
+		return Envelope{}, MalformedDataError{Data: "envelope"}
+	}
+	envelope.Nonce = body[:e.NonceSize()]
+	envelope.CipherText = body[e.NonceSize():]
+	return envelope, nil
+}
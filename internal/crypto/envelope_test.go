@@ -0,0 +1,138 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var algorithms = []string{AES, XChaCha20Poly1305}
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := GenerateRandomKey()
+	if err != nil {
+		t.Fatalf("GenerateRandomKey() failed: %s", err)
+	}
+	return key
+}
+
+// sealWithoutAAD encrypts plainText without additional data, the way ciphertexts were written before it was authenticated,
+// in the legacy format when version is 0 or else in an envelope of that version.
+func sealWithoutAAD(t *testing.T, e Encryption, key []byte, plainText string, version byte) string {
+	t.Helper()
+	nonce := make([]byte, e.NonceSize())
+	cipherText, err := e.Seal(key, nonce, []byte(plainText), nil)
+	if err != nil {
+		t.Fatalf("Seal() failed: %s", err)
+	}
+	if version == legacyVersion {
+		return hex.EncodeToString(append(nonce, cipherText...))
+	}
+	return Envelope{Version: version, Algorithm: e.ID(), KDF: KDFNone, Nonce: nonce, CipherText: cipherText}.Encode()
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	for _, algorithm := range algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			e, err := New(algorithm)
+			if err != nil {
+				t.Fatalf("New() failed: %s", err)
+			}
+			key := testKey(t)
+			aad := []byte("kittypass login\x00vault\x00login")
+			for _, plainText := range []string{"", "password", "pässwörd with ünicode and a very long tail of characters"} {
+				cipherText, err := Encrypt(e, KDFHKDFSHA256, key, plainText, aad)
+				if err != nil {
+					t.Fatalf("Encrypt() failed: %s", err)
+				}
+				if !IsEnvelope(cipherText) || !IsCurrent(cipherText) {
+					t.Fatalf("Encrypt() returned %q, expected an envelope in the current version", cipherText)
+				}
+				envelope, err := ParseEnvelope(cipherText, Aes{})
+				if err != nil {
+					t.Fatalf("ParseEnvelope() failed: %s", err)
+				}
+				if envelope.Version != EnvelopeVersion || envelope.Algorithm != e.ID() || envelope.KDF != KDFHKDFSHA256 {
+					t.Fatalf("ParseEnvelope() returned version %d, algorithm %d and kdf %d, expected %d, %d and %d",
+						envelope.Version, envelope.Algorithm, envelope.KDF, EnvelopeVersion, e.ID(), KDFHKDFSHA256)
+				}
+				if envelope.Encode() != cipherText {
+					t.Fatalf("encoding the parsed envelope returned %q, expected %q", envelope.Encode(), cipherText)
+				}
+				// the algorithm is read from the envelope, whatever the legacy algorithm is
+				decrypted, err := Decrypt(key, cipherText, aad, Aes{}, EnvelopeVersion)
+				if err != nil {
+					t.Fatalf("Decrypt() failed: %s", err)
+				}
+				if decrypted != plainText {
+					t.Fatalf("Decrypt() returned %q, expected %q", decrypted, plainText)
+				}
+			}
+		})
+	}
+}
+
+func TestDecryptAdditionalDataMismatch(t *testing.T) {
+	for _, algorithm := range algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			e, err := New(algorithm)
+			if err != nil {
+				t.Fatalf("New() failed: %s", err)
+			}
+			key := testKey(t)
+			cipherText, err := Encrypt(e, KDFHKDFSHA256, key, "password", []byte("kittypass login\x00vault\x00github"))
+			if err != nil {
+				t.Fatalf("Encrypt() failed: %s", err)
+			}
+			for name, aad := range map[string][]byte{
+				"other login": []byte("kittypass login\x00vault\x00gitlab"),
+				"other vault": []byte("kittypass login\x00other\x00github"),
+				"none":        nil,
+			} {
+				_, err := Decrypt(key, cipherText, aad, e, EnvelopeVersion)
+				if !errors.As(err, new(TamperedDataError)) {
+					t.Errorf("%s: Decrypt() returned %v, expected a TamperedDataError", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecryptBelowMinVersion(t *testing.T) {
+	for _, algorithm := range algorithms {
+		e, err := New(algorithm)
+		if err != nil {
+			t.Fatalf("New() failed: %s", err)
+		}
+		for _, version := range []byte{legacyVersion, 1} {
+			if version == legacyVersion && algorithm != AES {
+				// legacy ciphertexts were only written with AES
+				continue
+			}
+			t.Run(fmt.Sprintf("%s version %d", algorithm, version), func(t *testing.T) {
+				key := testKey(t)
+				cipherText := sealWithoutAAD(t, e, key, "password", version)
+
+				// older ciphertexts hold no additional data and are decrypted without it while the minimum allows them
+				decrypted, err := Decrypt(key, cipherText, []byte("ignored"), e, legacyVersion)
+				if err != nil {
+					t.Fatalf("Decrypt() failed: %s", err)
+				}
+				if decrypted != "password" {
+					t.Fatalf("Decrypt() returned %q, expected %q", decrypted, "password")
+				}
+
+				_, err = Decrypt(key, cipherText, nil, e, EnvelopeVersion)
+				var outdated OutdatedEnvelopeError
+				if !errors.As(err, &outdated) {
+					t.Fatalf("Decrypt() returned %v, expected an OutdatedEnvelopeError", err)
+				}
+				if outdated.Version != version || outdated.Minimum != EnvelopeVersion {
+					t.Fatalf("Decrypt() refused version %d below %d, expected version %d below %d", outdated.Version, outdated.Minimum, version, EnvelopeVersion)
+				}
+			})
+		}
+	}
+}
@@ -36,4 +36,43 @@ type MalformedDataError struct {
 
 func (e MalformedDataError) Error() string {
 	return fmt.Sprintf("data for %s is malformed, could not be processed", e.Data)
+}
+
+type UnsupportedAlgorithmError struct {
+	Algorithm string
+}
+
+func (e UnsupportedAlgorithmError) Error() string {
+	return fmt.Sprintf("unsupported encryption algorithm %q", e.Algorithm)
+}
+
+type UnsupportedEnvelopeError struct {
+	Version byte
+}
+
+func (e UnsupportedEnvelopeError) Error() string {
+	return fmt.Sprintf("unsupported ciphertext envelope version %d", e.Version)
+}
+
+type TamperedDataError struct{}
+
+func (e TamperedDataError) Error() string {
+	return "encrypted data failed authentication: it was modified or moved from another login or vault"
+}
+
+type OutdatedEnvelopeError struct {
+	Version byte
+	Minimum byte
+}
+
+func (e OutdatedEnvelopeError) Error() string {
+	return fmt.Sprintf("encrypted data in envelope version %d is older than the minimum version %d of its vault: it was restored from before the vault was upgraded", e.Version, e.Minimum)
+}
+
+type InvalidKDFParamsError struct {
+	Message string
+}
+
+func (e InvalidKDFParamsError) Error() string {
+	return fmt.Sprintf("invalid key derivation parameters: %s", e.Message)
 }
\ No newline at end of file
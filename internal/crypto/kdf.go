@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// KDFParams are the Argon2id parameters deriving a vault key from its master password.
+type KDFParams struct {
+	// Time is the number of passes over the memory.
+	Time uint32
+	// Memory is the amount of memory used, in KiB.
+	Memory uint32
+	// Threads is the degree of parallelism.
+	Threads uint8
+}
+
+// DefaultKDFParams are used for vaults created without explicit parameters, and for every vault created before parameters were stored.
+var DefaultKDFParams = KDFParams{Time: 1, Memory: 64 * 1024, Threads: 4}
+
+// maxCalibrationMemory caps the memory picked by Calibrate, in KiB.
+const maxCalibrationMemory = 1024 * 1024
+
+func (p KDFParams) Validate() error {
+	if p.Time < 1 {
+		return InvalidKDFParamsError{Message: "time must be at least 1"}
+	}
+	if p.Threads < 1 {
+		return InvalidKDFParamsError{Message: "parallelism must be at least 1"}
+	}
+	if p.Memory < 8*uint32(p.Threads) {
+		return InvalidKDFParamsError{Message: fmt.Sprintf("memory must be at least %d KiB for a parallelism of %d", 8*uint32(p.Threads), p.Threads)}
+	}
+	return nil
+}
+
+// Weaker reports whether deriving a key with p costs less than with other, measured as passes times memory.
+func (p KDFParams) Weaker(other KDFParams) bool {
+	return uint64(p.Time)*uint64(p.Memory) < uint64(other.Time)*uint64(other.Memory)
+}
+
+func (p KDFParams) String() string {
+	return fmt.Sprintf("time=%d memory=%dMiB parallelism=%d", p.Time, p.Memory/1024, p.Threads)
+}
+
+func GenerateKey(password, salt []byte, params KDFParams) []byte {
+	return argon2.IDKey(password, salt, params.Time, params.Memory, params.Threads, 32)
+}
+
+// Calibrate returns the strongest parameters, starting from base, deriving a key in at most target on this machine.
+// Memory is doubled first, up to 1 GiB, then passes are added. base is returned when it already takes longer than target.
+func Calibrate(target time.Duration, base KDFParams) KDFParams {
+	params := base
+	password := []byte("kittypass calibration")
+	salt := make([]byte, 16)
+	for {
+		next := params
+		if next.Memory < maxCalibrationMemory {
+			next.Memory *= 2
+		} else {
+			next.Time++
+		}
+		start := time.Now()
+		GenerateKey(password, salt, next)
+		if time.Since(start) > target {
+			return params
+		}
+		params = next
+	}
+}
@@ -0,0 +1,41 @@
+package crypto
+
+import (
+	"log"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// XChaCha20 encrypts with XChaCha20-Poly1305. Its 24 bytes nonce is safe to pick at random for any number of messages.
+type XChaCha20 struct{}
+
+func (x XChaCha20) ID() byte {
+	return 2
+}
+
+func (x XChaCha20) NonceSize() int {
+	return chacha20poly1305.NonceSizeX
+}
+
+func (x XChaCha20) Seal(key, nonce, plainText, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		log.Printf("encryption function received invalid encryption key length of %d, expect %d", len(key), chacha20poly1305.KeySize)
+		return nil, EncryptionKeyError{Message: "invalid encryption key length"}
+	}
+	return aead.Seal(nil, nonce, plainText, additionalData), nil
+}
+
+func (x XChaCha20) Open(key, nonce, cipherText, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		log.Printf("encryption function received invalid encryption key length of %d, expect %d", len(key), chacha20poly1305.KeySize)
+		return nil, EncryptionKeyError{Message: "invalid encryption key length"}
+	}
+	out, err := aead.Open(nil, nonce, cipherText, additionalData)
+	if err != nil {
+		log.Printf("failed to decrypt cipher text: %s", err)
+		return nil, DecryptionError{}
+	}
+	return out, nil
+}
@@ -0,0 +1,20 @@
+package hibp
+
+import "fmt"
+
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return fmt.Sprintf("failed to read password list %s: %s", e.Path, e.Err)
+}
+
+type MalformedFileError struct {
+	Path string
+}
+
+func (e MalformedFileError) Error() string {
+	return fmt.Sprintf("%s is not a Have I Been Pwned password list ordered by hash", e.Path)
+}
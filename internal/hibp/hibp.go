@@ -0,0 +1,137 @@
+package hibp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+)
+
+// The Have I Been Pwned password list is a text file of upper case SHA-1 hashes of breached passwords, one per line,
+// each followed by the number of times the password was seen in breaches: "<hash>:<count>". Only the list ordered by
+// hash can be searched: lookups binary search the file on disk instead of loading it, as it weighs tens of gigabytes.
+
+const hashLength = sha1.Size * 2
+
+// File is an opened Have I Been Pwned password list ordered by hash.
+type File struct {
+	file *os.File
+	size int64
+}
+
+// Open opens the password list at path and checks that its first line is a SHA-1 hash.
+func Open(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, FileError{Path: path, Err: err}
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, FileError{Path: path, Err: err}
+	}
+	f := &File{file: file, size: info.Size()}
+	_, line, err := f.lineFrom(0)
+	if errors.Is(err, io.EOF) || (err == nil && !validHash(line)) {
+		err = MalformedFileError{Path: path}
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+// Count returns how many times password was seen in breaches, 0 when it is not in the list.
+func (f *File) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	target := []byte(hex.EncodeToString(sum[:]))
+	target = bytes.ToUpper(target)
+
+	// lo and hi bound the offsets where the line of the hash can start
+	lo, hi := int64(0), f.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := f.lineFrom(mid)
+		if errors.Is(err, io.EOF) || start >= hi {
+			hi = mid
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !validHash(line) {
+			return 0, MalformedFileError{Path: f.file.Name()}
+		}
+		switch bytes.Compare(bytes.ToUpper(line[:hashLength]), target) {
+		case 0:
+			return parseCount(line, f.file.Name())
+		case -1:
+			lo = start + int64(len(line)) + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, nil
+}
+
+// lineFrom returns the first line starting at offset or after it, and the offset where it starts, without its line ending.
+func (f *File) lineFrom(offset int64) (int64, []byte, error) {
+	start := offset
+	if offset > 0 {
+		// a line starts at offset when the previous byte ends a line, so reading starts from that byte
+		start = offset - 1
+	}
+	reader := bufio.NewReaderSize(io.NewSectionReader(f.file, start, f.size-start), 256)
+	if offset > 0 {
+		skipped, err := reader.ReadSlice('\n')
+		if err != nil {
+			return 0, nil, f.readError(err)
+		}
+		start += int64(len(skipped))
+	}
+	line, err := reader.ReadSlice('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+		return 0, nil, f.readError(err)
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return start, bytes.TrimSuffix(line, []byte("\r")), nil
+}
+
+func (f *File) readError(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return MalformedFileError{Path: f.file.Name()}
+	}
+	return FileError{Path: f.file.Name(), Err: err}
+}
+
+func validHash(line []byte) bool {
+	if len(line) < hashLength || (len(line) > hashLength && line[hashLength] != ':') {
+		return false
+	}
+	_, err := hex.DecodeString(string(line[:hashLength]))
+	return err == nil
+}
+
+// parseCount reads the count following the hash, lists without counts count every hash once.
+func parseCount(line []byte, path string) (int, error) {
+	if len(line) == hashLength {
+		return 1, nil
+	}
+	count, err := strconv.Atoi(string(line[hashLength+1:]))
+	if err != nil || count < 1 {
+		return 0, MalformedFileError{Path: path}
+	}
+	return count, nil
+}
@@ -0,0 +1,148 @@
+package kittypass
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/mrtnhwtt/kittypass/internal/hibp"
+)
+
+// AuditedLogin is a login found by an audit. It never holds the password.
+type AuditedLogin struct {
+	Vault    string
+	Name     string
+	Username string
+	Strength Strength
+	// PasswordChanged is when the password of the login was last set.
+	PasswordChanged time.Time
+}
+
+// AuditReport lists the logins of the audited vaults that need attention.
+type AuditReport struct {
+	Logins int
+	// Reused groups the logins sharing the same password.
+	Reused [][]AuditedLogin
+	// Weak lists the logins whose password scores below the minimum strength score.
+	Weak []AuditedLogin
+	// Old lists the logins whose password was last changed before the maximum age.
+	Old []AuditedLogin
+	// SharedCredentials groups the logins of different vaults sharing the same username and password.
+	SharedCredentials [][]AuditedLogin
+}
+
+// Audit decrypts every login of the vaults and reports reused, weak and old passwords, and credentials shared across vaults.
+// The vaults must have been unlocked.
+func Audit(vaults []*Vault, minScore int, maxAge time.Duration, now time.Time) (AuditReport, error) {
+	var report AuditReport
+	byPassword := map[string][]AuditedLogin{}
+	var passwords []string
+
+	for _, v := range vaults {
+		loginList, err := v.Storage.ReadLogins(v.Uuid)
+		if err != nil {
+			return AuditReport{}, err
+		}
+		for _, login := range loginList {
+			password, err := v.decryptPassword(login["name"], login["hex_enc_pass"], login["hex_salt"])
+			if err != nil {
+				return AuditReport{}, err
+			}
+			changed, err := time.Parse(time.RFC3339, login["date_password_changed"])
+			if err != nil {
+				log.Printf("error when parsing password change date of login %s: %s", login["name"], err)
+				return AuditReport{}, MalformedDataError{Data: "password change date"}
+			}
+			audited := AuditedLogin{
+				Vault:           v.Name,
+				Name:            login["name"],
+				Username:        login["username"],
+				Strength:        EstimateStrength(password, login["name"], login["username"], v.Name),
+				PasswordChanged: changed,
+			}
+			report.Logins++
+			if audited.Strength.Score < minScore {
+				report.Weak = append(report.Weak, audited)
+			}
+			if maxAge > 0 && now.Sub(changed) > maxAge {
+				report.Old = append(report.Old, audited)
+			}
+			if _, found := byPassword[password]; !found {
+				passwords = append(passwords, password)
+			}
+			byPassword[password] = append(byPassword[password], audited)
+		}
+	}
+
+	// passwords are only used as keys while grouping, the report keeps the order in which they were found
+	for _, password := range passwords {
+		logins := byPassword[password]
+		if len(logins) > 1 {
+			report.Reused = append(report.Reused, logins)
+		}
+		report.SharedCredentials = append(report.SharedCredentials, sharedAcrossVaults(logins)...)
+	}
+	sort.SliceStable(report.Old, func(i, j int) bool {
+		return report.Old[i].PasswordChanged.Before(report.Old[j].PasswordChanged)
+	})
+	return report, nil
+}
+
+// sharedAcrossVaults groups logins with the same password by username, keeping the groups spanning several vaults.
+func sharedAcrossVaults(logins []AuditedLogin) [][]AuditedLogin {
+	var usernames []string
+	byUsername := map[string][]AuditedLogin{}
+	for _, login := range logins {
+		if _, found := byUsername[login.Username]; !found {
+			usernames = append(usernames, login.Username)
+		}
+		byUsername[login.Username] = append(byUsername[login.Username], login)
+	}
+	var shared [][]AuditedLogin
+	for _, username := range usernames {
+		group := byUsername[username]
+		vaults := map[string]bool{}
+		for _, login := range group {
+			vaults[login.Vault] = true
+		}
+		if len(vaults) > 1 {
+			shared = append(shared, group)
+		}
+	}
+	return shared
+}
+
+// BreachedLogin is a login whose password appears in a list of breached passwords.
+type BreachedLogin struct {
+	Vault    string
+	Name     string
+	Username string
+	// Occurrences is the number of times the password was seen in breaches.
+	Occurrences int
+}
+
+// AuditBreaches decrypts every login of the vaults and looks their password up in the Have I Been Pwned password list.
+// The vaults must have been unlocked.
+func AuditBreaches(vaults []*Vault, list *hibp.File) ([]BreachedLogin, error) {
+	var breached []BreachedLogin
+	for _, v := range vaults {
+		loginList, err := v.Storage.ReadLogins(v.Uuid)
+		if err != nil {
+			return nil, err
+		}
+		for _, login := range loginList {
+			password, err := v.decryptPassword(login["name"], login["hex_enc_pass"], login["hex_salt"])
+			if err != nil {
+				return nil, err
+			}
+			count, err := list.Count(password)
+			if err != nil {
+				return nil, err
+			}
+			if count > 0 {
+				breached = append(breached, BreachedLogin{Vault: v.Name, Name: login["name"], Username: login["username"], Occurrences: count})
+			}
+		}
+	}
+	return breached, nil
+}
@@ -1,6 +1,11 @@
 package kittypass
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mrtnhwtt/kittypass/internal/crypto"
+)
 
 type MalformedDataError struct {
 	Data string
@@ -10,8 +15,82 @@ func (e MalformedDataError) Error() string {
 	return fmt.Sprintf("data for %s is malformed, could not be processed", e.Data)
 }
 
-type IncorrectPasswordError struct {}
+type IncorrectPasswordError struct{}
 
 func (e IncorrectPasswordError) Error() string {
 	return "incorrect password"
-}
\ No newline at end of file
+}
+
+type MigrationVerificationError struct {
+	Reason string
+}
+
+func (e MigrationVerificationError) Error() string {
+	return fmt.Sprintf("migrated vault failed verification at destination: %s", e.Reason)
+}
+
+type WeakerKDFParamsError struct {
+	Current   crypto.KDFParams
+	Requested crypto.KDFParams
+}
+
+func (e WeakerKDFParamsError) Error() string {
+	return fmt.Sprintf("key derivation parameters %s are weaker than the current %s", e.Requested, e.Current)
+}
+
+type RandomSourceError struct{}
+
+func (e RandomSourceError) Error() string {
+	return "failed to read from the system random source"
+}
+
+type InvalidGeneratorError struct {
+	Message string
+}
+
+func (e InvalidGeneratorError) Error() string {
+	return e.Message
+}
+
+type WeakPasswordError struct {
+	Score   int
+	Minimum int
+}
+
+func (e WeakPasswordError) Error() string {
+	return fmt.Sprintf("password strength score %d is below the minimum score %d, choose a stronger password or use --force", e.Score, e.Minimum)
+}
+
+type BreachedPasswordError struct {
+	Occurrences int
+}
+
+func (e BreachedPasswordError) Error() string {
+	return fmt.Sprintf("password was seen %d times in data breaches, choose another password or use --force", e.Occurrences)
+}
+
+type InvalidReferenceError struct {
+	Reference string
+	Message   string
+}
+
+func (e InvalidReferenceError) Error() string {
+	return fmt.Sprintf("invalid reference %s: %s", e.Reference, e.Message)
+}
+
+type UnsupportedImportFormatError struct {
+	Format string
+}
+
+func (e UnsupportedImportFormatError) Error() string {
+	return fmt.Sprintf("unsupported import format %s, expected one of %s", e.Format, strings.Join(ImportFormats, ", "))
+}
+
+type MalformedImportError struct {
+	Line    int
+	Message string
+}
+
+func (e MalformedImportError) Error() string {
+	return fmt.Sprintf("malformed export on line %d: %s", e.Line, e.Message)
+}
@@ -1,53 +1,314 @@
 package kittypass
 
-import "math/rand"
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/big"
+	"strings"
+)
 
+var (
+	lowercaseChars = []rune("abcdefghijklmnopqrstuvwxyz")
+	numberChars    = []rune("0123456789")
+	uppercaseChars = []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	specialChars   = []rune("!#$%&*+-?@^_~")
+)
+
+// randomSource is the source of randomness of generated passwords and passphrases.
+var randomSource io.Reader = rand.Reader
+
+// ambiguousChars are left out of the generated passwords when AvoidAmbiguous is set.
+const ambiguousChars = "0O1lI|"
+
+// maxAttempts bounds how many passwords are drawn before giving up on one satisfying MaxConsecutive.
+const maxAttempts = 1000
+
+// PasswordGenerator holds the options of generated passwords. Saved in a Policy, it is stored as JSON.
 type PasswordGenerator struct {
-	Length      int
-	SpecialChar bool
-	Numeral     bool
-	Uppercase   bool
+	Length      int  `json:"length"`
+	SpecialChar bool `json:"special_char,omitempty"`
+	Numeral     bool `json:"numeral,omitempty"`
+	Uppercase   bool `json:"uppercase,omitempty"`
+	// Passphrase generates diceware-style passphrases of Words words joined by Separator instead of random characters.
+	Passphrase bool   `json:"passphrase,omitempty"`
+	Words      int    `json:"words,omitempty"`
+	Separator  string `json:"separator,omitempty"`
+	// MinLowercase, MinUppercase, MinNumeral and MinSpecial are the minimum number of characters of each class.
+	// A minimum above zero enables its class. Every enabled class gets at least one character.
+	MinLowercase int `json:"min_lowercase,omitempty"`
+	MinUppercase int `json:"min_uppercase,omitempty"`
+	MinNumeral   int `json:"min_numeral,omitempty"`
+	MinSpecial   int `json:"min_special,omitempty"`
+	// Symbols replaces the default set of special characters.
+	Symbols string `json:"symbols,omitempty"`
+	// Exclude lists characters never used in the generated passwords.
+	Exclude        string `json:"exclude,omitempty"`
+	AvoidAmbiguous bool   `json:"avoid_ambiguous,omitempty"`
+	// NoRepeat uses every character at most once.
+	NoRepeat bool `json:"no_repeat,omitempty"`
+	// MaxConsecutive is the longest run of the same character allowed, zero meaning no limit.
+	MaxConsecutive int `json:"max_consecutive,omitempty"`
+}
+
+// charClass is a set of allowed characters and the minimum number of them in a generated password.
+type charClass struct {
+	chars []rune
+	min   int
 }
 
-func (g *PasswordGenerator) GeneratePassword() string {
-	lowercase := []rune("abcdefghijklmnopqrstuvwxyz")
-	numbers := []rune("0123456789")
-	uppercase := []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
-	specialChars := []rune("!#$%&*+-?@^_~")
+// Validate checks that passwords can be generated with the generator options: the length of the generated passwords,
+// or the number of words of the generated passphrases, and that the character rules can be satisfied together.
+func (g *PasswordGenerator) Validate() error {
+	if g.Passphrase {
+		if g.Words < 3 || g.Words > 20 {
+			return InvalidGeneratorError{Message: fmt.Sprintf("invalid passphrase word count %d, please set a word count between 3 and 20", g.Words)}
+		}
+		if g.SpecialChar && len(g.symbols()) == 0 {
+			return InvalidGeneratorError{Message: "no special character left to add to the passphrase"}
+		}
+		return nil
+	}
+	if g.Length < 5 || g.Length > 64 {
+		return InvalidGeneratorError{Message: fmt.Sprintf("invalid password length %d, please set a password length between 5 and 64", g.Length)}
+	}
+	if g.MinLowercase < 0 || g.MinUppercase < 0 || g.MinNumeral < 0 || g.MinSpecial < 0 || g.MaxConsecutive < 0 {
+		return InvalidGeneratorError{Message: "minimum character counts and maximum consecutive characters cannot be negative"}
+	}
+	classes, err := g.classes()
+	if err != nil {
+		return err
+	}
+	required, available := 0, 0
+	for _, class := range classes {
+		if g.NoRepeat && class.min > len(class.chars) {
+			return InvalidGeneratorError{Message: fmt.Sprintf("cannot use %d distinct characters out of %q", class.min, string(class.chars))}
+		}
+		required += class.min
+		available += len(class.chars)
+	}
+	if required > g.Length {
+		return InvalidGeneratorError{Message: fmt.Sprintf("minimum character counts add up to %d, above the password length %d", required, g.Length)}
+	}
+	if g.NoRepeat && available < g.Length {
+		return InvalidGeneratorError{Message: fmt.Sprintf("only %d distinct characters are allowed, too few for a password of length %d without repeats", available, g.Length)}
+	}
+	if g.MaxConsecutive == 1 && available < 2 {
+		return InvalidGeneratorError{Message: "at least two distinct characters are needed to avoid consecutive characters"}
+	}
+	return nil
+}
 
-	var selectedChars []rune
+// GeneratePassword returns a random password following the generator options, or a passphrase when Passphrase is set.
+// Characters and words are drawn from crypto/rand. Returns an error when the system random source cannot be read.
+func (g *PasswordGenerator) GeneratePassword() (string, error) {
+	if err := g.Validate(); err != nil {
+		return "", err
+	}
+	if g.Passphrase {
+		return g.generatePassphrase()
+	}
+	classes, err := g.classes()
+	if err != nil {
+		return "", err
+	}
+	// passwords breaking the consecutive characters rule are drawn again, keeping the accepted passwords uniformly distributed
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		password, err := g.drawPassword(classes)
+		if err != nil {
+			return "", err
+		}
+		if g.MaxConsecutive == 0 || longestRun(password) <= g.MaxConsecutive {
+			return string(password), nil
+		}
+	}
+	return "", InvalidGeneratorError{Message: fmt.Sprintf("could not generate a password without more than %d consecutive identical characters", g.MaxConsecutive)}
+}
 
-	selectedChars = append(selectedChars, lowercase[rand.Intn(len(lowercase))])
+// drawPassword picks the minimum number of characters of every class, fills the rest of the password from all the classes and shuffles it.
+func (g *PasswordGenerator) drawPassword(classes []charClass) ([]rune, error) {
+	used := map[rune]bool{}
+	pick := func(chars []rune) (rune, error) {
+		if g.NoRepeat {
+			var unused []rune
+			for _, char := range chars {
+				if !used[char] {
+					unused = append(unused, char)
+				}
+			}
+			chars = unused
+		}
+		char, err := randomRune(chars)
+		if err != nil {
+			return 0, err
+		}
+		used[char] = true
+		return char, nil
+	}
 
-	if g.Numeral {
-		selectedChars = append(selectedChars, numbers[rand.Intn(len(numbers))])
+	var selectedChars, allChars []rune
+	for _, class := range classes {
+		for i := 0; i < class.min; i++ {
+			char, err := pick(class.chars)
+			if err != nil {
+				return nil, err
+			}
+			selectedChars = append(selectedChars, char)
+		}
+		allChars = append(allChars, class.chars...)
 	}
-	if g.Uppercase {
-		selectedChars = append(selectedChars, uppercase[rand.Intn(len(uppercase))])
+
+	for len(selectedChars) < g.Length {
+		char, err := pick(allChars)
+		if err != nil {
+			return nil, err
+		}
+		selectedChars = append(selectedChars, char)
 	}
-	if g.SpecialChar {
-		selectedChars = append(selectedChars, specialChars[rand.Intn(len(specialChars))])
+
+	if err := shuffle(selectedChars); err != nil {
+		return nil, err
 	}
+	return selectedChars, nil
+}
 
-	allChars := lowercase
-	if g.Numeral {
-		allChars = append(allChars, numbers...)
+// Entropy returns the entropy in bits of the passwords or passphrases generated with the generator options.
+// For passwords it does not account for the minimum characters of each class, which lower it slightly.
+func (g *PasswordGenerator) Entropy() float64 {
+	if g.Passphrase {
+		return g.passphraseEntropy()
 	}
-	if g.Uppercase {
-		allChars = append(allChars, uppercase...)
+	classes, err := g.classes()
+	if err != nil {
+		return 0
 	}
-	if g.SpecialChar {
-		allChars = append(allChars, specialChars...)
+	size := 0
+	for _, class := range classes {
+		size += len(class.chars)
 	}
+	if g.NoRepeat {
+		bits := 0.0
+		for i := 0; i < g.Length && size-i > 0; i++ {
+			bits += math.Log2(float64(size - i))
+		}
+		return bits
+	}
+	return float64(g.Length) * math.Log2(float64(size))
+}
+
+// classes returns the character classes enabled in the generator, without the excluded characters.
+// Lowercase characters are always enabled. A character is only kept in the first class holding it, as custom symbols
+// can repeat characters of the other classes, so that the classes never share characters.
+func (g *PasswordGenerator) classes() ([]charClass, error) {
+	candidates := []struct {
+		name    string
+		chars   []rune
+		enabled bool
+		min     int
+	}{
+		{"lowercase", lowercaseChars, true, g.MinLowercase},
+		{"numeral", numberChars, g.Numeral || g.MinNumeral > 0, g.MinNumeral},
+		{"uppercase", uppercaseChars, g.Uppercase || g.MinUppercase > 0, g.MinUppercase},
+		{"special", g.symbols(), g.SpecialChar || g.MinSpecial > 0, g.MinSpecial},
+	}
+	var classes []charClass
+	taken := map[rune]bool{}
+	for _, candidate := range candidates {
+		if !candidate.enabled {
+			continue
+		}
+		var chars []rune
+		for _, char := range g.allowed(candidate.chars) {
+			if !taken[char] {
+				taken[char] = true
+				chars = append(chars, char)
+			}
+		}
+		if len(chars) == 0 {
+			return nil, InvalidGeneratorError{Message: fmt.Sprintf("every %s character is excluded or already in another class", candidate.name)}
+		}
+		classes = append(classes, charClass{chars: chars, min: max(candidate.min, 1)})
+	}
+	return classes, nil
+}
 
-	remainingLength := g.Length - len(selectedChars)
-	for i := 0; i < remainingLength; i++ {
-		selectedChars = append(selectedChars, allChars[rand.Intn(len(allChars))])
+// symbols returns the special characters of the generator, the custom Symbols when set, without the excluded characters.
+func (g *PasswordGenerator) symbols() []rune {
+	if g.Symbols != "" {
+		return g.allowed(uniqueRunes(g.Symbols))
 	}
+	return g.allowed(specialChars)
+}
+
+// allowed returns chars without the excluded characters, and without the ambiguous ones when AvoidAmbiguous is set.
+func (g *PasswordGenerator) allowed(chars []rune) []rune {
+	var allowed []rune
+	for _, char := range chars {
+		if strings.ContainsRune(g.Exclude, char) || (g.AvoidAmbiguous && strings.ContainsRune(ambiguousChars, char)) {
+			continue
+		}
+		allowed = append(allowed, char)
+	}
+	return allowed
+}
 
-	rand.Shuffle(len(selectedChars), func(i, j int) {
-		selectedChars[i], selectedChars[j] = selectedChars[j], selectedChars[i]
-	})
+func uniqueRunes(s string) []rune {
+	seen := map[rune]bool{}
+	var runes []rune
+	for _, r := range s {
+		if !seen[r] {
+			seen[r] = true
+			runes = append(runes, r)
+		}
+	}
+	return runes
+}
 
-	return string(selectedChars)
+// longestRun returns the length of the longest run of the same character in chars.
+func longestRun(chars []rune) int {
+	longest, run := 0, 0
+	for i := range chars {
+		if i > 0 && chars[i] == chars[i-1] {
+			run++
+		} else {
+			run = 1
+		}
+		longest = max(longest, run)
+	}
+	return longest
+}
+
+// randomIndex returns a uniformly distributed integer in [0, n) read from the random source.
+func randomIndex(n int) (int, error) {
+	if n <= 0 {
+		return 0, InvalidGeneratorError{Message: "no character or word left to choose from"}
+	}
+	i, err := rand.Int(randomSource, big.NewInt(int64(n)))
+	if err != nil {
+		log.Printf("failed to read from the random source: %s", err)
+		return 0, RandomSourceError{}
+	}
+	return int(i.Int64()), nil
+}
+
+func randomRune(chars []rune) (rune, error) {
+	i, err := randomIndex(len(chars))
+	if err != nil {
+		return 0, err
+	}
+	return chars[i], nil
+}
+
+// shuffle permutes chars in place with a Fisher-Yates shuffle, so that the minimum characters of each class end up at random positions.
+func shuffle(chars []rune) error {
+	for i := len(chars) - 1; i > 0; i-- {
+		j, err := randomIndex(i + 1)
+		if err != nil {
+			return err
+		}
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+	return nil
 }
@@ -0,0 +1,218 @@
+package kittypass
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// classOf returns the class of a character generated with the default symbols.
+func classOf(char rune) string {
+	switch {
+	case unicode.IsLower(char):
+		return "lowercase"
+	case unicode.IsUpper(char):
+		return "uppercase"
+	case unicode.IsDigit(char):
+		return "numeral"
+	}
+	return "special"
+}
+
+// chiSquareCritical approximates the critical value of the chi-square distribution with df degrees of freedom
+// at a one in a million false positive rate, with the Wilson-Hilferty transformation.
+func chiSquareCritical(df int) float64 {
+	const z = 4.753
+	k := float64(df)
+	return k * math.Pow(1-2/(9*k)+z*math.Sqrt(2/(9*k)), 3)
+}
+
+func TestGeneratePasswordDistribution(t *testing.T) {
+	g := PasswordGenerator{Length: 16, Numeral: true, Uppercase: true, SpecialChar: true}
+	counts := map[string]map[rune]int{}
+	for i := 0; i < 20000; i++ {
+		password, err := g.GeneratePassword()
+		if err != nil {
+			t.Fatalf("GeneratePassword() failed: %s", err)
+		}
+		for _, char := range password {
+			class := classOf(char)
+			if counts[class] == nil {
+				counts[class] = map[rune]int{}
+			}
+			counts[class][char]++
+		}
+	}
+
+	classes := map[string][]rune{
+		"lowercase": lowercaseChars,
+		"numeral":   numberChars,
+		"uppercase": uppercaseChars,
+		"special":   specialChars,
+	}
+	for name, chars := range classes {
+		total := 0
+		for _, char := range chars {
+			total += counts[name][char]
+		}
+		if len(counts[name]) != len(chars) {
+			t.Errorf("%s: %d distinct characters generated, expected %d", name, len(counts[name]), len(chars))
+		}
+		// characters are drawn uniformly within their class
+		expected := float64(total) / float64(len(chars))
+		chiSquare := 0.0
+		for _, char := range chars {
+			diff := float64(counts[name][char]) - expected
+			chiSquare += diff * diff / expected
+		}
+		if critical := chiSquareCritical(len(chars) - 1); chiSquare > critical {
+			t.Errorf("%s: chi-square %.1f above the critical value %.1f, characters are not uniformly distributed", name, chiSquare, critical)
+		}
+	}
+}
+
+func TestGeneratePasswordPositionDistribution(t *testing.T) {
+	// the guaranteed characters are shuffled with the rest: uppercase characters land at every position equally often
+	g := PasswordGenerator{Length: 8, Uppercase: true, Numeral: true}
+	positions := make([]int, g.Length)
+	const runs = 20000
+	for i := 0; i < runs; i++ {
+		password, err := g.GeneratePassword()
+		if err != nil {
+			t.Fatalf("GeneratePassword() failed: %s", err)
+		}
+		for position, char := range []rune(password) {
+			if unicode.IsUpper(char) {
+				positions[position]++
+			}
+		}
+	}
+	total := 0
+	for _, count := range positions {
+		total += count
+	}
+	expected := float64(total) / float64(len(positions))
+	chiSquare := 0.0
+	for _, count := range positions {
+		diff := float64(count) - expected
+		chiSquare += diff * diff / expected
+	}
+	if critical := chiSquareCritical(len(positions) - 1); chiSquare > critical {
+		t.Errorf("chi-square %.1f above the critical value %.1f, uppercase characters are not uniformly placed: %v", chiSquare, critical, positions)
+	}
+}
+
+func TestGeneratePasswordGuarantees(t *testing.T) {
+	tests := []struct {
+		name string
+		g    PasswordGenerator
+	}{
+		{"lowercase only", PasswordGenerator{Length: 5}},
+		{"one per class", PasswordGenerator{Length: 5, Numeral: true, Uppercase: true, SpecialChar: true}},
+		{"minimum counts", PasswordGenerator{Length: 12, MinLowercase: 2, MinUppercase: 3, MinNumeral: 4, MinSpecial: 3}},
+		{"minimum enables class", PasswordGenerator{Length: 10, MinNumeral: 6}},
+		{"custom symbols", PasswordGenerator{Length: 20, SpecialChar: true, Symbols: "=.", MinSpecial: 2}},
+		{"overlapping symbols", PasswordGenerator{Length: 27, SpecialChar: true, Symbols: "a!", NoRepeat: true}},
+		{"exclusions", PasswordGenerator{Length: 30, Numeral: true, Uppercase: true, Exclude: "aeiou02468", AvoidAmbiguous: true}},
+		{"no repeat", PasswordGenerator{Length: 64, Numeral: true, Uppercase: true, SpecialChar: true, NoRepeat: true}},
+		{"max consecutive", PasswordGenerator{Length: 40, Numeral: true, Exclude: "abcdefghijklmnopqrstuvwxy", MaxConsecutive: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classes, err := tt.g.classes()
+			if err != nil {
+				t.Fatalf("classes() failed: %s", err)
+			}
+			for i := 0; i < 500; i++ {
+				password, err := tt.g.GeneratePassword()
+				if err != nil {
+					t.Fatalf("GeneratePassword() failed: %s", err)
+				}
+				chars := []rune(password)
+				if len(chars) != tt.g.Length {
+					t.Fatalf("password %q has length %d, expected %d", password, len(chars), tt.g.Length)
+				}
+
+				allowed := map[rune]bool{}
+				for _, class := range classes {
+					count := 0
+					for _, char := range class.chars {
+						allowed[char] = true
+						count += strings.Count(password, string(char))
+					}
+					if count < class.min {
+						t.Fatalf("password %q has %d characters of %q, expected at least %d", password, count, string(class.chars), class.min)
+					}
+				}
+				seen := map[rune]bool{}
+				for _, char := range chars {
+					if !allowed[char] {
+						t.Fatalf("password %q holds %q, outside of the enabled classes", password, char)
+					}
+					if tt.g.NoRepeat && seen[char] {
+						t.Fatalf("password %q repeats %q", password, char)
+					}
+					seen[char] = true
+				}
+				if tt.g.MaxConsecutive > 0 && longestRun(chars) > tt.g.MaxConsecutive {
+					t.Fatalf("password %q has more than %d consecutive identical characters", password, tt.g.MaxConsecutive)
+				}
+			}
+		})
+	}
+}
+
+func TestGeneratePasswordInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		g    PasswordGenerator
+	}{
+		{"too short", PasswordGenerator{Length: 4}},
+		{"too long", PasswordGenerator{Length: 65}},
+		{"negative minimum", PasswordGenerator{Length: 10, MinNumeral: -1}},
+		{"minimums above length", PasswordGenerator{Length: 8, MinUppercase: 5, MinNumeral: 4}},
+		{"class excluded", PasswordGenerator{Length: 10, Numeral: true, Exclude: "0123456789"}},
+		{"not enough distinct characters", PasswordGenerator{Length: 27, NoRepeat: true}},
+		{"symbols in another class", PasswordGenerator{Length: 27, SpecialChar: true, Symbols: "a", NoRepeat: true}},
+		{"symbols in other classes", PasswordGenerator{Length: 64, SpecialChar: true, Numeral: true, Uppercase: true, Symbols: "abc", NoRepeat: true}},
+		{"too few words", PasswordGenerator{Passphrase: true, Words: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.g.GeneratePassword()
+			if !errors.As(err, new(InvalidGeneratorError)) {
+				t.Fatalf("GeneratePassword() returned %v, expected an InvalidGeneratorError", err)
+			}
+		})
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("random source unavailable")
+}
+
+func TestGeneratePasswordRandomSourceFailure(t *testing.T) {
+	source := randomSource
+	randomSource = failingReader{}
+	defer func() { randomSource = source }()
+
+	generators := map[string]PasswordGenerator{
+		"password":   {Length: 16, Numeral: true, Uppercase: true, SpecialChar: true},
+		"passphrase": {Passphrase: true, Words: 6, Separator: "-"},
+	}
+	for name, g := range generators {
+		t.Run(name, func(t *testing.T) {
+			password, err := g.GeneratePassword()
+			if !errors.As(err, new(RandomSourceError)) {
+				t.Fatalf("GeneratePassword() returned %v, expected a RandomSourceError", err)
+			}
+			if password != "" {
+				t.Fatalf("GeneratePassword() returned %q along with its error", password)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package kittypass
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/mrtnhwtt/kittypass/internal/storage"
+)
+
+// ImportFormats are the CSV exports of other password managers that logins can be imported from.
+var ImportFormats = []string{"bitwarden-csv", "chrome-csv", "firefox-csv", "1password-csv", "lastpass-csv"}
+
+// importColumns gives, for each format, the header names of the columns holding each field, lowercased.
+// A field is read from the first of its columns present in the header.
+var importColumns = map[string]map[string][]string{
+	"bitwarden-csv": {
+		"type":     {"type"},
+		"name":     {"name"},
+		"username": {"login_username"},
+		"password": {"login_password"},
+		"url":      {"login_uri"},
+		"notes":    {"notes"},
+	},
+	"chrome-csv": {
+		"name":     {"name"},
+		"username": {"username"},
+		"password": {"password"},
+		"url":      {"url"},
+		"notes":    {"note", "notes"},
+	},
+	"firefox-csv": {
+		"username": {"username"},
+		"password": {"password"},
+		"url":      {"url"},
+	},
+	"1password-csv": {
+		"name":     {"title"},
+		"username": {"username"},
+		"password": {"password"},
+		"url":      {"url", "website"},
+		"notes":    {"notes"},
+	},
+	"lastpass-csv": {
+		"name":     {"name"},
+		"username": {"username"},
+		"password": {"password"},
+		"url":      {"url"},
+		"notes":    {"extra"},
+	},
+}
+
+// lastPassSecureNoteURL is the URL LastPass exports secure notes with.
+const lastPassSecureNoteURL = "http://sn"
+
+// ImportedLogin is a login read from the export of another password manager.
+// URL and Notes are read from exports that have them, but are not saved as logins do not hold them yet.
+type ImportedLogin struct {
+	Name     string
+	Username string
+	Password string
+	URL      string
+	Notes    string
+	// Line is the line of the export the login starts on.
+	Line int
+}
+
+// ImportReport describes an import: the logins added to the vault, and the ones left out because a login of
+// the vault or an earlier login of the export already has their name.
+type ImportReport struct {
+	Imported   []ImportedLogin
+	Duplicates []ImportedLogin
+}
+
+// ParseImport reads the logins of a CSV export in one of the ImportFormats, and counts the entries skipped because they are
+// not logins, such as notes and cards. Logins without a name are named after the host of their URL and their username,
+// such as "example.com (martin)", so that several accounts on the same site do not clash.
+func ParseImport(format string, r io.Reader) ([]ImportedLogin, int, error) {
+	columns, found := importColumns[format]
+	if !found {
+		return nil, 0, UnsupportedImportFormatError{Format: format}
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, 0, MalformedImportError{Line: 1, Message: "the export is empty"}
+	}
+	if err != nil {
+		return nil, 0, importReadError(err)
+	}
+	position := map[string]int{}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if _, found := position[column]; !found {
+			position[column] = i
+		}
+	}
+	index := map[string]int{}
+	for field, names := range columns {
+		for _, name := range names {
+			if i, found := position[name]; found {
+				index[field] = i
+				break
+			}
+		}
+	}
+	if _, found := index["password"]; !found {
+		return nil, 0, MalformedImportError{Line: 1, Message: fmt.Sprintf("no password column, is the export in the %s format?", format)}
+	}
+
+	var logins []ImportedLogin
+	skipped := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, 0, importReadError(err)
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			i, found := index[name]
+			if !found || i >= len(record) {
+				return ""
+			}
+			return record[i]
+		}
+
+		if typ := field("type"); typ != "" && typ != "login" {
+			skipped++
+			continue
+		}
+		login := ImportedLogin{
+			Name:     strings.TrimSpace(field("name")),
+			Username: field("username"),
+			Password: field("password"),
+			URL:      strings.TrimSpace(field("url")),
+			Notes:    field("notes"),
+			Line:     line,
+		}
+		if format == "lastpass-csv" && login.URL == lastPassSecureNoteURL {
+			skipped++
+			continue
+		}
+		if login.Password == "" && login.Username == "" {
+			skipped++
+			continue
+		}
+		if login.Name == "" {
+			login.Name = derivedName(login.URL, login.Username)
+		}
+		if login.Name == "" {
+			return nil, 0, MalformedImportError{Line: line, Message: "the login has neither a name nor a URL to name it after"}
+		}
+		logins = append(logins, login)
+	}
+	return logins, skipped, nil
+}
+
+func importReadError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return MalformedImportError{Line: parseErr.StartLine, Message: parseErr.Err.Error()}
+	}
+	return err
+}
+
+// derivedName names a login without a name after the host of its URL and its username.
+// It is empty when the URL has no host.
+func derivedName(rawURL, username string) string {
+	host := hostOf(rawURL)
+	if host == "" || username == "" {
+		return host
+	}
+	return fmt.Sprintf("%s (%s)", host, username)
+}
+
+// hostOf returns the host of a URL without its port, or an empty string if it has none.
+func hostOf(rawURL string) string {
+	if rawURL == "" {
+		return ""
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// Import adds the logins to the vault in a single transaction, leaving out the ones whose name is already used by
+// a login of the vault or an earlier login of the list. With dryRun, the report is made but nothing is saved.
+// The vault must have been unlocked.
+func (v *Vault) Import(logins []ImportedLogin, dryRun bool) (ImportReport, error) {
+	stored, err := v.Storage.ReadLogins(v.Uuid)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	taken := map[string]bool{}
+	for _, login := range stored {
+		taken[storage.LoginIdentifier(v.Uuid, login["name"])] = true
+	}
+
+	var report ImportReport
+	var loginList []map[string]string
+	for _, login := range logins {
+		identifier := storage.LoginIdentifier(v.Uuid, login.Name)
+		if taken[identifier] {
+			report.Duplicates = append(report.Duplicates, login)
+			continue
+		}
+		taken[identifier] = true
+		report.Imported = append(report.Imported, login)
+		if dryRun {
+			continue
+		}
+		cipher, hexSalt, err := v.encryptPassword(login.Name, login.Password)
+		if err != nil {
+			return ImportReport{}, err
+		}
+		loginList = append(loginList, map[string]string{
+			"name":                 login.Name,
+			"username":             login.Username,
+			"hexEncryptedPassword": cipher,
+			"hexSalt":              hexSalt,
+		})
+	}
+	if dryRun || len(loginList) == 0 {
+		return report, nil
+	}
+	if _, err := v.Storage.SaveLogins(v.Uuid, loginList); err != nil {
+		return ImportReport{}, err
+	}
+	return report, nil
+}
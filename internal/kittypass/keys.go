@@ -0,0 +1,191 @@
+package kittypass
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/mrtnhwtt/kittypass/internal/crypto"
+	"github.com/mrtnhwtt/kittypass/internal/storage"
+)
+
+// encryption returns the encryption algorithm configured for the vault. New ciphertexts are encrypted with it,
+// existing ones are decrypted with the algorithm recorded in their envelope.
+func (v *Vault) encryption() (crypto.Encryption, error) {
+	return crypto.New(v.Cipher)
+}
+
+// wrapDataKey encrypts the data key under the derivation key.
+func (v *Vault) wrapDataKey() error {
+	e, err := v.encryption()
+	if err != nil {
+		return err
+	}
+	wrapped, err := crypto.Encrypt(e, crypto.KDFArgon2id, v.DerivationKey, hex.EncodeToString(v.DataKey), v.dataKeyAAD())
+	if err != nil {
+		return err
+	}
+	v.HexWrappedKey = wrapped
+	return nil
+}
+
+// unwrapDataKey decrypts the data key with the derivation key.
+// Vaults created before data keys existed have no wrapped key: their derivation key is used as data key.
+func (v *Vault) unwrapDataKey() error {
+	if v.HexWrappedKey == "" {
+		v.DataKey = v.DerivationKey
+		return nil
+	}
+	e, err := v.encryption()
+	if err != nil {
+		return err
+	}
+	hexKey, err := crypto.Decrypt(v.DerivationKey, v.HexWrappedKey, v.dataKeyAAD(), e, v.MinEnvelopeVersion)
+	if err != nil {
+		return err
+	}
+	v.DataKey, err = hex.DecodeString(hexKey)
+	if err != nil {
+		log.Printf("error when decoding unwrapped data key: %s", err)
+		return MalformedDataError{Data: "data key"}
+	}
+	return nil
+}
+
+// keyCheckValue is the plaintext of the key check value.
+const keyCheckValue = "kittypass key check"
+
+// createKeyCheck encrypts the key check value under the derivation key.
+func (v *Vault) createKeyCheck() error {
+	e, err := v.encryption()
+	if err != nil {
+		return err
+	}
+	check, err := crypto.Encrypt(e, crypto.KDFArgon2id, v.DerivationKey, keyCheckValue, v.keyCheckAAD())
+	if err != nil {
+		return err
+	}
+	v.HexKeyCheck = check
+	return nil
+}
+
+// verifyKeyCheck decrypts the key check value with the derivation key. A derivation key recreated from a wrong master password fails authentication.
+func (v *Vault) verifyKeyCheck() error {
+	e, err := v.encryption()
+	if err != nil {
+		return err
+	}
+	value, err := crypto.Decrypt(v.DerivationKey, v.HexKeyCheck, v.keyCheckAAD(), e, v.MinEnvelopeVersion)
+	if err != nil {
+		if errors.As(err, &crypto.TamperedDataError{}) {
+			return IncorrectPasswordError{}
+		}
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(value), []byte(keyCheckValue)) != 1 {
+		return IncorrectPasswordError{}
+	}
+	return nil
+}
+
+// loginKey derives the key encrypting a single login from the vault data key and the login salt,
+// so that exposing the key of one login does not expose the others.
+// Logins stored before per-login salts have no salt and are encrypted with the vault data key itself.
+func (v *Vault) loginKey(hexSalt string) ([]byte, error) {
+	if hexSalt == "" {
+		return v.DataKey, nil
+	}
+	salt, err := hex.DecodeString(hexSalt)
+	if err != nil {
+		log.Printf("error when decoding login salt: %s", err)
+		return nil, MalformedDataError{Data: "login salt"}
+	}
+	return crypto.DeriveSubkey(v.DataKey, salt, "kittypass login password")
+}
+
+// keyCheckAAD binds the key check value to its vault and, once raised, to the oldest envelope version the vault decrypts,
+// so that lowering that version in the database makes the key check fail.
+func (v *Vault) keyCheckAAD() []byte {
+	aad := "kittypass key check\x00" + v.Uuid
+	if v.MinEnvelopeVersion > 0 {
+		aad += "\x00" + strconv.Itoa(int(v.MinEnvelopeVersion))
+	}
+	return []byte(aad)
+}
+
+// dataKeyAAD binds the wrapped data key to its vault.
+func (v *Vault) dataKeyAAD() []byte {
+	return []byte("kittypass data key\x00" + v.Uuid)
+}
+
+// loginAAD binds a login ciphertext to its vault and login identifier, so that a ciphertext swapped with the one of another login fails to decrypt.
+// The identifier is computed from the vault uuid and the login name, never read from the stored row it protects.
+func (v *Vault) loginAAD(name string) []byte {
+	return []byte("kittypass login\x00" + v.Uuid + "\x00" + storage.LoginIdentifier(v.Uuid, name))
+}
+
+// encryptPassword encrypts the password of the named login under a key derived from a new random login salt.
+// Returns the hex encoded ciphertext and salt.
+func (v *Vault) encryptPassword(name, password string) (string, string, error) {
+	salt, err := crypto.GenerateRandomSalt(16)
+	if err != nil {
+		return "", "", err
+	}
+	hexSalt := hex.EncodeToString(salt)
+	key, err := v.loginKey(hexSalt)
+	if err != nil {
+		return "", "", err
+	}
+	e, err := v.encryption()
+	if err != nil {
+		return "", "", err
+	}
+	cipher, err := crypto.Encrypt(e, crypto.KDFHKDFSHA256, key, password, v.loginAAD(name))
+	if err != nil {
+		return "", "", err
+	}
+	return cipher, hexSalt, nil
+}
+
+func (v *Vault) decryptPassword(name, cipher, hexSalt string) (string, error) {
+	key, err := v.loginKey(hexSalt)
+	if err != nil {
+		return "", err
+	}
+	e, err := v.encryption()
+	if err != nil {
+		return "", err
+	}
+	return crypto.Decrypt(key, cipher, v.loginAAD(name), e, v.MinEnvelopeVersion)
+}
+
+// requireCurrentEnvelopes records that the vault refuses ciphertexts older than the current envelope version. The key check
+// value is re-encrypted to authenticate the new minimum, and the wrapped data key when it predates the current envelope version.
+// Every login of the vault must already be current.
+func (v *Vault) requireCurrentEnvelopes() error {
+	if v.MinEnvelopeVersion >= crypto.EnvelopeVersion {
+		return nil
+	}
+	previous, previousKeyCheck, previousWrappedKey := v.MinEnvelopeVersion, v.HexKeyCheck, v.HexWrappedKey
+	restore := func() {
+		v.MinEnvelopeVersion, v.HexKeyCheck, v.HexWrappedKey = previous, previousKeyCheck, previousWrappedKey
+	}
+	v.MinEnvelopeVersion = crypto.EnvelopeVersion
+	if err := v.createKeyCheck(); err != nil {
+		restore()
+		return err
+	}
+	if v.HexWrappedKey != "" && !crypto.IsCurrent(v.HexWrappedKey) {
+		if err := v.wrapDataKey(); err != nil {
+			restore()
+			return err
+		}
+	}
+	if err := v.Storage.RaiseMinEnvelopeVersion(v.Uuid, v.HexKeyCheck, v.HexWrappedKey, int(crypto.EnvelopeVersion)); err != nil {
+		restore()
+		return err
+	}
+	return nil
+}
@@ -1,11 +1,6 @@
 package kittypass
 
-import (
-
-	"github.com/mrtnhwtt/kittypass/internal/crypto"
-	"github.com/mrtnhwtt/kittypass/internal/storage"
-)
-
+// Login is a username and password pair stored in a Vault. It reads and writes through the storage backend of its Vault.
 type Login struct {
 	Vault           *Vault
 	Password        string
@@ -13,6 +8,8 @@ type Login struct {
 	Name            string
 	ProvidePassword bool
 	Generator       PasswordGenerator
+	// Policy is the name of the password policy generating the passwords of the login, if any.
+	Policy string
 }
 
 func NewLogin() Login {
@@ -22,18 +19,11 @@ func NewLogin() Login {
 }
 
 func (l *Login) Add() error {
-	e := crypto.New("aes")
-	cipher, err := e.Encrypt(l.Vault.DerivationKey, l.Password)
+	cipher, hexSalt, err := l.Vault.encryptPassword(l.Name, l.Password)
 	if err != nil {
 		return err
 	}
-	db, err := storage.New("./database.db")
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	_, err = db.SaveLogin(l.Vault.Uuid, l.Name, l.Username, cipher)
+	_, err = l.Vault.Storage.SaveLogin(l.Vault.Uuid, l.Name, l.Username, cipher, hexSalt, l.Policy)
 	if err != nil {
 		return err
 	}
@@ -41,22 +31,11 @@ func (l *Login) Add() error {
 }
 
 func (l *Login) Get() (map[string]string, error) {
-	db, err := storage.New("./database.db")
+	stored, err := l.Vault.Storage.ReadLogin(l.Vault.Uuid, l.Name)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
-
-	stored, err := db.ReadLogin(l.Vault.Uuid, l.Name)
-	if err != nil {
-		return nil, err
-	}
-	err = l.Vault.RecreateDerivationKey()
-	if err != nil {
-		return nil, err
-	}
-	e := crypto.New("aes")
-	decrypted, err := e.Decrypt(l.Vault.DerivationKey, stored["hex_encrypted_password"])
+	decrypted, err := l.Vault.decryptPassword(stored["name"], stored["hex_encrypted_password"], stored["hex_salt"])
 	if err != nil {
 		return nil, err
 	}
@@ -69,12 +48,7 @@ func (l *Login) Get() (map[string]string, error) {
 }
 
 func (l *Login) List() ([]map[string]string, error) {
-	db, err := storage.New("./database.db")
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-	loginList, err := db.ListLogin(l.Vault.Uuid, l.Name, l.Username)
+	loginList, err := l.Vault.Storage.ListLogin(l.Vault.Uuid, l.Name, l.Username)
 	if err != nil {
 		return nil, err
 	}
@@ -82,30 +56,56 @@ func (l *Login) List() ([]map[string]string, error) {
 }
 
 func (l *Login) Delete() error {
-	db, err := storage.New("./database.db")
-	if err != nil {
+	return l.Vault.Storage.DeleteLogin(l.Vault.Uuid, l.Name)
+}
+
+// UsePolicy sets the generator options of the login to the ones of the named policy, and records the policy on the login when it is saved.
+func (l *Login) UsePolicy(name string) error {
+	policy := Policy{Storage: l.Vault.Storage, Name: name}
+	if err := policy.Get(); err != nil {
 		return err
 	}
-	defer db.Close()
-	return db.DeleteLogin(l.Vault.Uuid, l.Name)
+	l.Generator = policy.Generator
+	l.Policy = name
+	return nil
+}
+
+// SavedPolicy returns the name of the policy recorded on the login named target, empty when it has none.
+func (l *Login) SavedPolicy(target string) (string, error) {
+	stored, err := l.Vault.Storage.ReadLogin(l.Vault.Uuid, target)
+	if err != nil {
+		return "", err
+	}
+	return stored["policy"], nil
 }
 
+// Update changes the name, username, password or policy of the login named target, ignoring empty values.
+// Renaming a login re-encrypts its password, as the ciphertext is bound to the login identifier.
 func (l *Login) Update(target string) (int64, error) {
-	var cipher string
+	var cipher, hexSalt string
 	var err error
-	if l.Password != "" {
-		e := crypto.New("aes")
-		cipher, err = e.Encrypt(l.Vault.DerivationKey, l.Password)
+	password := l.Password
+	if password == "" && l.Name != "" && l.Name != target {
+		stored, err := l.Vault.Storage.ReadLogin(l.Vault.Uuid, target)
+		if err != nil {
+			return 0, err
+		}
+		password, err = l.Vault.decryptPassword(stored["name"], stored["hex_encrypted_password"], stored["hex_salt"])
 		if err != nil {
 			return 0, err
 		}
 	}
-	db, err := storage.New("./database.db")
-	if err != nil {
-		return 0, err
+	if password != "" {
+		name := l.Name
+		if name == "" {
+			name = target
+		}
+		cipher, hexSalt, err = l.Vault.encryptPassword(name, password)
+		if err != nil {
+			return 0, err
+		}
 	}
-	defer db.Close()
-	aff, err := db.UpdateLogin(l.Vault.Uuid, target, l.Name, l.Username, cipher)
+	aff, err := l.Vault.Storage.UpdateLogin(l.Vault.Uuid, target, l.Name, l.Username, cipher, hexSalt, l.Policy, l.Password != "")
 	if err != nil {
 		return 0, err
 	}
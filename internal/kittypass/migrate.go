@@ -0,0 +1,93 @@
+package kittypass
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"log"
+	"sort"
+
+	"github.com/mrtnhwtt/kittypass/internal/storage"
+)
+
+// MigrationResult describes a vault copied by Vault.Migrate.
+type MigrationResult struct {
+	Logins        int
+	Checksum      string
+	SourceDeleted bool
+}
+
+// Migrate copies the vault and all its logins from its storage backend to dst. Passwords are copied encrypted, without being decrypted.
+// The copy is verified by comparing the number of logins and a checksum of every column of the vault and its logins at the destination.
+// When deleteSource is true, the vault is deleted from its backend once the copy is verified.
+func (v *Vault) Migrate(dst storage.Backend, deleteSource bool) (MigrationResult, error) {
+	vaultData, loginList, err := v.Storage.ExportVault(v.Name)
+	if err != nil {
+		return MigrationResult{}, err
+	}
+	checksum := vaultChecksum(vaultData, loginList)
+
+	if err := dst.ImportVault(vaultData, loginList); err != nil {
+		return MigrationResult{}, err
+	}
+
+	if err := verifyMigration(dst, v.Name, len(loginList), checksum); err != nil {
+		// do not leave a copy that failed verification at the destination
+		if _, delErr := dst.DeleteVault(v.Name, vaultData["uuid"]); delErr != nil {
+			log.Printf("failed to remove unverified copy of vault %s from destination: %s", v.Name, delErr)
+		}
+		return MigrationResult{}, err
+	}
+
+	result := MigrationResult{Logins: len(loginList), Checksum: checksum}
+	if deleteSource {
+		if _, err := v.Storage.DeleteVault(v.Name, vaultData["uuid"]); err != nil {
+			return result, err
+		}
+		result.SourceDeleted = true
+	}
+	return result, nil
+}
+
+func verifyMigration(dst storage.Backend, name string, count int, checksum string) error {
+	copiedVault, copied, err := dst.ExportVault(name)
+	if err != nil {
+		return err
+	}
+	if len(copied) != count {
+		log.Printf("migrated vault %s has %d logins at destination, expected %d", name, len(copied), count)
+		return MigrationVerificationError{Reason: "login count mismatch"}
+	}
+	if vaultChecksum(copiedVault, copied) != checksum {
+		log.Printf("migrated vault %s checksum mismatch at destination", name)
+		return MigrationVerificationError{Reason: "checksum mismatch"}
+	}
+	return nil
+}
+
+// vaultChecksum hashes every column of the vault row, including the bcrypt hash of legacy vaults, then every column of each login,
+// in identifier order. Columns are hashed along with their name, in name order.
+func vaultChecksum(vault map[string]string, loginList []map[string]string) string {
+	h := sha256.New()
+	writeRow(h, vault)
+	for _, login := range loginList {
+		writeRow(h, login)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeRow(h hash.Hash, row map[string]string) {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		h.Write([]byte(column))
+		h.Write([]byte{0})
+		h.Write([]byte(row[column]))
+		h.Write([]byte{0})
+	}
+	// separates rows so that a column cannot be moved to the next row unnoticed
+	h.Write([]byte{1})
+}
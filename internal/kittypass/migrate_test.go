@@ -0,0 +1,114 @@
+package kittypass
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrtnhwtt/kittypass/internal/storage"
+)
+
+// corruptingBackend changes one column of the vault or of its logins when they are imported.
+type corruptingBackend struct {
+	*storage.Storage
+	login  bool
+	column string
+}
+
+func (b corruptingBackend) ImportVault(vault map[string]string, loginList []map[string]string) error {
+	vaultRow := copyRow(vault)
+	var loginRows []map[string]string
+	for _, login := range loginList {
+		loginRows = append(loginRows, copyRow(login))
+	}
+	if b.login {
+		loginRows[0][b.column] += "1"
+	} else {
+		vaultRow[b.column] += "1"
+	}
+	return b.Storage.ImportVault(vaultRow, loginRows)
+}
+
+func copyRow(row map[string]string) map[string]string {
+	copied := make(map[string]string, len(row))
+	for column, value := range row {
+		copied[column] = value
+	}
+	return copied
+}
+
+func TestMigrateDetectsCorruptedColumn(t *testing.T) {
+	tests := []struct {
+		login  bool
+		column string
+	}{
+		{false, "description"},
+		{false, "cipher"},
+		{false, "hex_key_check"},
+		{false, "hex_salt"},
+		{false, "hex_wrapped_key"},
+		{false, "kdf_time"},
+		{false, "kdf_memory"},
+		{false, "kdf_threads"},
+		{false, "min_envelope_version"},
+		{false, "hex_hashed_master_password"},
+		{true, "username"},
+		{true, "hex_encrypted_password"},
+		{true, "hex_salt"},
+		{true, "policy"},
+	}
+	for _, tt := range tests {
+		name := "vault " + tt.column
+		if tt.login {
+			name = "login " + tt.column
+		}
+		t.Run(name, func(t *testing.T) {
+			vault, _ := newTestVault(t)
+			dst, err := storage.New(filepath.Join(t.TempDir(), "destination.db"))
+			if err != nil {
+				t.Fatalf("storage.New() failed: %s", err)
+			}
+			defer dst.Close()
+
+			_, err = vault.Migrate(corruptingBackend{Storage: dst, login: tt.login, column: tt.column}, true)
+			if !errors.As(err, new(MigrationVerificationError)) {
+				t.Fatalf("Migrate() returned %v, expected a MigrationVerificationError", err)
+			}
+			if _, err := dst.GetVault(vault.Name); !errors.As(err, new(storage.VaultNotFound)) {
+				t.Fatalf("the unverified copy was left at the destination: GetVault() returned %v", err)
+			}
+			if _, err := vault.Storage.GetVault(vault.Name); err != nil {
+				t.Fatalf("the source vault was deleted after a failed migration: %s", err)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	vault, _ := newTestVault(t)
+	dst, err := storage.New(filepath.Join(t.TempDir(), "destination.db"))
+	if err != nil {
+		t.Fatalf("storage.New() failed: %s", err)
+	}
+	defer dst.Close()
+
+	result, err := vault.Migrate(dst, true)
+	if err != nil {
+		t.Fatalf("Migrate() failed: %s", err)
+	}
+	if result.Logins != 1 || !result.SourceDeleted {
+		t.Fatalf("Migrate() returned %+v, expected 1 login and the source deleted", result)
+	}
+	migrated, err := openTestVault(dst, vault.Name, vault.Masterpass)
+	if err != nil {
+		t.Fatalf("opening the migrated vault failed: %s", err)
+	}
+	login := Login{Vault: &migrated, Name: "github"}
+	stored, err := login.Get()
+	if err != nil {
+		t.Fatalf("reading the migrated login failed: %s", err)
+	}
+	if stored["password"] != "login password" {
+		t.Fatalf("migrated login has password %q, expected %q", stored["password"], "login password")
+	}
+}
@@ -0,0 +1,79 @@
+package kittypass
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// effLargeWordlist is the EFF large wordlist for passphrases, https://www.eff.org/dice.
+// Each line holds the five dice rolls of a word and the word, separated by a tab.
+//
+//go:embed eff_large_wordlist.txt
+var effLargeWordlist string
+
+var passphraseWords = sync.OnceValue(func() []string {
+	var words []string
+	for _, line := range strings.Split(strings.TrimSpace(effLargeWordlist), "\n") {
+		_, word, _ := strings.Cut(line, "\t")
+		words = append(words, strings.TrimSpace(word))
+	}
+	return words
+})
+
+// generatePassphrase returns Words random words of the EFF large wordlist joined by Separator.
+// Uppercase capitalizes every word, Numeral and SpecialChar each append a random digit or symbol to a random word.
+func (g *PasswordGenerator) generatePassphrase() (string, error) {
+	wordlist := passphraseWords()
+	words := make([]string, g.Words)
+	for i := range words {
+		index, err := randomIndex(len(wordlist))
+		if err != nil {
+			return "", err
+		}
+		words[i] = wordlist[index]
+		if g.Uppercase {
+			words[i] = capitalize(words[i])
+		}
+	}
+
+	var insertions [][]rune
+	if g.Numeral {
+		insertions = append(insertions, numberChars)
+	}
+	if g.SpecialChar {
+		insertions = append(insertions, g.symbols())
+	}
+	for _, chars := range insertions {
+		char, err := randomRune(chars)
+		if err != nil {
+			return "", err
+		}
+		index, err := randomIndex(len(words))
+		if err != nil {
+			return "", err
+		}
+		words[index] += string(char)
+	}
+	return strings.Join(words, g.Separator), nil
+}
+
+// passphraseEntropy returns the entropy in bits of the passphrases generated with the generator options.
+func (g *PasswordGenerator) passphraseEntropy() float64 {
+	bits := float64(g.Words) * math.Log2(float64(len(passphraseWords())))
+	if g.Numeral {
+		bits += math.Log2(float64(len(numberChars) * g.Words))
+	}
+	if g.SpecialChar {
+		bits += math.Log2(float64(len(g.symbols()) * g.Words))
+	}
+	return bits
+}
+
+func capitalize(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + word[size:]
+}
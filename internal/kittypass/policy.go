@@ -0,0 +1,66 @@
+package kittypass
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/mrtnhwtt/kittypass/internal/storage"
+)
+
+// Policy is a named set of password generator options, so that the logins of a site keep getting passwords the site accepts.
+type Policy struct {
+	Storage   storage.Backend
+	Name      string
+	Generator PasswordGenerator
+}
+
+func (p *Policy) Save() error {
+	if err := p.Generator.Validate(); err != nil {
+		return err
+	}
+	options, err := json.Marshal(p.Generator)
+	if err != nil {
+		return err
+	}
+	_, err = p.Storage.SavePolicy(p.Name, string(options))
+	return err
+}
+
+func (p *Policy) Get() error {
+	policy, err := p.Storage.GetPolicy(p.Name)
+	if err != nil {
+		return err
+	}
+	p.Generator, err = parsePolicyOptions(policy["options"])
+	return err
+}
+
+// List returns the saved policies, with their generator options.
+func (p *Policy) List() ([]Policy, error) {
+	policyList, err := p.Storage.ListPolicy()
+	if err != nil {
+		return nil, err
+	}
+	var policies []Policy
+	for _, policy := range policyList {
+		generator, err := parsePolicyOptions(policy["options"])
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, Policy{Storage: p.Storage, Name: policy["name"], Generator: generator})
+	}
+	return policies, nil
+}
+
+func (p *Policy) Delete() error {
+	return p.Storage.DeletePolicy(p.Name)
+}
+
+func parsePolicyOptions(options string) (PasswordGenerator, error) {
+	var generator PasswordGenerator
+	if err := json.Unmarshal([]byte(options), &generator); err != nil {
+		log.Printf("error when parsing policy options: %s", err)
+		return PasswordGenerator{}, MalformedDataError{Data: "policy options"}
+	}
+	return generator, nil
+}
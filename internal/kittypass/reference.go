@@ -0,0 +1,108 @@
+package kittypass
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mrtnhwtt/kittypass/internal/storage"
+)
+
+// ReferenceScheme starts the references to the fields of logins.
+const ReferenceScheme = "kp://"
+
+// Reference points at a field of a login: kp://<vault>/<login>/<password|username>. The field is password when omitted.
+// Names holding a slash or a space are percent-encoded, as in URL paths.
+type Reference struct {
+	Vault string
+	Login string
+	Field string
+}
+
+func ParseReference(s string) (Reference, error) {
+	path, found := strings.CutPrefix(s, ReferenceScheme)
+	if !found {
+		return Reference{}, InvalidReferenceError{Reference: s, Message: fmt.Sprintf("must start with %s", ReferenceScheme)}
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) == 2 {
+		parts = append(parts, "password")
+	}
+	if len(parts) != 3 {
+		return Reference{}, InvalidReferenceError{Reference: s, Message: "expected kp://<vault>/<login>/<password|username>"}
+	}
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil || unescaped == "" {
+			return Reference{}, InvalidReferenceError{Reference: s, Message: "expected kp://<vault>/<login>/<password|username>"}
+		}
+		parts[i] = unescaped
+	}
+	if parts[2] != "password" && parts[2] != "username" {
+		return Reference{}, InvalidReferenceError{Reference: s, Message: fmt.Sprintf("unknown field %s, expected password or username", parts[2])}
+	}
+	return Reference{Vault: parts[0], Login: parts[1], Field: parts[2]}, nil
+}
+
+func (r Reference) String() string {
+	return ReferenceScheme + url.PathEscape(r.Vault) + "/" + url.PathEscape(r.Login) + "/" + r.Field
+}
+
+// Resolver reads the values that references point at. Every vault is unlocked once, the first time one of its logins is read,
+// and every login is decrypted once.
+type Resolver struct {
+	Storage storage.Backend
+	// Unlock opens a vault that has its Name and Storage set.
+	Unlock func(v *Vault) error
+	vaults map[string]*Vault
+	// logins are keyed by references without field
+	logins map[Reference]map[string]string
+}
+
+// Resolve returns the value of every reference. References are resolved vault by vault, in the order the vaults first appear.
+func (r *Resolver) Resolve(refs []Reference) (map[Reference]string, error) {
+	if r.vaults == nil {
+		r.vaults = map[string]*Vault{}
+		r.logins = map[Reference]map[string]string{}
+	}
+	var vaultNames []string
+	byVault := map[string][]Reference{}
+	for _, ref := range refs {
+		if _, found := byVault[ref.Vault]; !found {
+			vaultNames = append(vaultNames, ref.Vault)
+		}
+		byVault[ref.Vault] = append(byVault[ref.Vault], ref)
+	}
+
+	values := map[Reference]string{}
+	for _, name := range vaultNames {
+		vault, found := r.vaults[name]
+		if !found {
+			v := NewVault()
+			v.Name = name
+			v.Storage = r.Storage
+			if err := r.Unlock(&v); err != nil {
+				return nil, err
+			}
+			vault = &v
+			r.vaults[name] = vault
+		}
+		for _, ref := range byVault[name] {
+			key := Reference{Vault: ref.Vault, Login: ref.Login}
+			stored, found := r.logins[key]
+			if !found {
+				login := NewLogin()
+				login.Vault = vault
+				login.Name = ref.Login
+				var err error
+				stored, err = login.Get()
+				if err != nil {
+					return nil, fmt.Errorf("failed to resolve %s: %w", ref, err)
+				}
+				r.logins[key] = stored
+			}
+			values[ref] = stored[ref.Field]
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,278 @@
+package kittypass
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Password strength is estimated offline, in the way of zxcvbn: the password is split into the sequence of known patterns
+// (common passwords, dictionary words, names, keyboard walks, sequences, repeats and dates) that is the fastest to guess,
+// and the number of guesses an attacker needs is estimated from the patterns found.
+
+// maxAnalyzedLength bounds the part of the password matched against patterns. Characters past it are not taken into account,
+// which can only underestimate the strength of very long passwords.
+const maxAnalyzedLength = 100
+
+// offlineGuessesPerSecond is the guess rate of an attacker holding a slow hash of the password, such as bcrypt or Argon2.
+const offlineGuessesPerSecond = 1e4
+
+// Strength is the estimated strength of a password.
+type Strength struct {
+	// Score ranges from 0, too guessable, to 4, very unguessable.
+	Score int
+	// GuessesLog10 is the base 10 logarithm of the estimated number of guesses needed to find the password.
+	GuessesLog10 float64
+	// Warning explains what makes the password weak, empty for strong passwords.
+	Warning     string
+	Suggestions []string
+}
+
+// ScoreLabels name the strength scores.
+var ScoreLabels = []string{"very weak", "weak", "fair", "strong", "very strong"}
+
+// EstimateStrength estimates the strength of password. userInputs are words an attacker would try first,
+// such as the login name or username.
+func EstimateStrength(password string, userInputs ...string) Strength {
+	runes := []rune(password)
+	if len(runes) > maxAnalyzedLength {
+		runes = runes[:maxAnalyzedLength]
+	}
+	guessesLog10, sequence := mostGuessableSequence(runes, userInputs)
+
+	strength := Strength{Score: guessesScore(guessesLog10), GuessesLog10: guessesLog10}
+	strength.Warning, strength.Suggestions = feedback(strength.Score, sequence)
+	return strength
+}
+
+// CrackTime describes how long an attacker holding a slow hash of the password would need to guess it.
+func (s Strength) CrackTime() string {
+	seconds := math.Pow(10, s.GuessesLog10) / offlineGuessesPerSecond
+	units := []struct {
+		name    string
+		seconds float64
+	}{
+		{"century", 100 * 365.25 * 24 * 3600},
+		{"year", 365.25 * 24 * 3600},
+		{"month", 365.25 / 12 * 24 * 3600},
+		{"day", 24 * 3600},
+		{"hour", 3600},
+		{"minute", 60},
+		{"second", 1},
+	}
+	if seconds < 1 {
+		return "less than a second"
+	}
+	if seconds >= 100*units[0].seconds {
+		return "centuries"
+	}
+	for _, unit := range units {
+		if seconds >= unit.seconds {
+			count := int(math.Round(seconds / unit.seconds))
+			if count == 1 {
+				return fmt.Sprintf("1 %s", unit.name)
+			}
+			if unit.name == "century" {
+				return fmt.Sprintf("%d centuries", count)
+			}
+			return fmt.Sprintf("%d %ss", count, unit.name)
+		}
+	}
+	return "less than a second"
+}
+
+// Label names the score of the strength.
+func (s Strength) Label() string {
+	return ScoreLabels[s.Score]
+}
+
+func guessesScore(guessesLog10 float64) int {
+	switch {
+	case guessesLog10 < 3:
+		return 0
+	case guessesLog10 < 6:
+		return 1
+	case guessesLog10 < 8:
+		return 2
+	case guessesLog10 < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// mostGuessableSequence returns the estimated guesses of the sequence of non-overlapping matches covering the password
+// that an attacker would find first, with that sequence. Parts of the password no pattern matches are guessed by brute force.
+func mostGuessableSequence(password []rune, userInputs []string) (float64, []strengthMatch) {
+	n := len(password)
+	if n == 0 {
+		return 0, nil
+	}
+	matches := findMatches(password, userInputs)
+	byEnd := make([][]strengthMatch, n)
+	for _, m := range matches {
+		m.guessesLog10 = math.Max(m.guessesLog10, minimumGuessesLog10(m, n))
+		byEnd[m.j] = append(byEnd[m.j], m)
+	}
+
+	// best[k][l] holds the lowest sum of the guesses logarithms covering the first k characters with l matches
+	type step struct {
+		log10 float64
+		match strengthMatch
+		valid bool
+	}
+	best := make([][]step, n+1)
+	for k := range best {
+		best[k] = make([]step, n+1)
+	}
+	best[0][0] = step{valid: true}
+	for k := 1; k <= n; k++ {
+		for l := 1; l <= k; l++ {
+			candidate := func(i int, m strengthMatch) {
+				previous := best[i][l-1]
+				if !previous.valid {
+					return
+				}
+				total := previous.log10 + m.guessesLog10
+				if !best[k][l].valid || total < best[k][l].log10 {
+					best[k][l] = step{log10: total, match: m, valid: true}
+				}
+			}
+			for _, m := range byEnd[k-1] {
+				candidate(m.i, m)
+			}
+			for i := 0; i < k; i++ {
+				candidate(i, bruteforceMatch(password, i, k-1))
+			}
+		}
+	}
+
+	// an attacker tries sequences of fewer patterns first: l patterns can come in l! orders, plus an additive penalty per pattern
+	bestLength, bestGuesses := 0, math.Inf(1)
+	for l := 1; l <= n; l++ {
+		if !best[n][l].valid {
+			continue
+		}
+		orders := logFactorial10(l) + best[n][l].log10
+		penalty := 4 * float64(l-1)
+		guesses := sumLog10(orders, penalty)
+		if guesses < bestGuesses {
+			bestLength, bestGuesses = l, guesses
+		}
+	}
+
+	sequence := make([]strengthMatch, bestLength)
+	k := n
+	for l := bestLength; l > 0; l-- {
+		m := best[k][l].match
+		sequence[l-1] = m
+		k = m.i
+	}
+	return bestGuesses, sequence
+}
+
+// minimumGuessesLog10 keeps a match covering part of the password from being counted as nearly free.
+func minimumGuessesLog10(m strengthMatch, passwordLength int) float64 {
+	if m.j-m.i+1 == passwordLength {
+		return 0
+	}
+	if m.j == m.i {
+		return 1
+	}
+	return math.Log10(50)
+}
+
+func bruteforceMatch(password []rune, i, j int) strengthMatch {
+	return strengthMatch{pattern: bruteforcePattern, i: i, j: j, token: string(password[i : j+1]), guessesLog10: float64(j - i + 1)}
+}
+
+func logFactorial10(n int) float64 {
+	lgamma, _ := math.Lgamma(float64(n + 1))
+	return lgamma / math.Ln10
+}
+
+// sumLog10 returns log10(10^a + 10^b).
+func sumLog10(a, b float64) float64 {
+	high, low := math.Max(a, b), math.Min(a, b)
+	return high + math.Log10(1+math.Pow(10, low-high))
+}
+
+// feedback explains the weakness of a password from the patterns it is made of.
+func feedback(score int, sequence []strengthMatch) (string, []string) {
+	if len(sequence) == 0 {
+		return "", []string{"Use a few words, avoid common phrases.", "No need for symbols, digits, or uppercase letters."}
+	}
+	if score > 2 {
+		return "", nil
+	}
+	longest := sequence[0]
+	for _, m := range sequence[1:] {
+		if m.j-m.i > longest.j-longest.i {
+			longest = m
+		}
+	}
+	suggestions := []string{"Add another word or two. Uncommon words are better."}
+	alone := len(sequence) == 1
+
+	switch longest.pattern {
+	case dictionaryPattern:
+		warning := ""
+		switch longest.dictionary {
+		case "passwords":
+			switch {
+			case alone && !longest.reversed && longest.l33t == "" && longest.rank <= 10:
+				warning = "This is a top-10 common password."
+			case alone && !longest.reversed && longest.l33t == "" && longest.rank <= 100:
+				warning = "This is a top-100 common password."
+			case alone:
+				warning = "This is a very common password."
+			default:
+				warning = "This is similar to a commonly used password."
+			}
+		case "english":
+			if alone {
+				warning = "A word by itself is easy to guess."
+			}
+		case "surnames", "first names":
+			if alone {
+				warning = "Names and surnames by themselves are easy to guess."
+			} else {
+				warning = "Common names and surnames are easy to guess."
+			}
+		case "user inputs":
+			warning = "Names related to this login are easy to guess."
+		}
+		token := []rune(longest.token)
+		if strings.ToUpper(longest.token) == longest.token && strings.ToLower(longest.token) != longest.token {
+			suggestions = append(suggestions, "All-uppercase is almost as easy to guess as all-lowercase.")
+		} else if len(token) > 0 && strings.ToUpper(string(token[0])) == string(token[0]) && strings.ToLower(string(token[0])) != string(token[0]) {
+			suggestions = append(suggestions, "Capitalization doesn't help very much.")
+		}
+		if longest.reversed && len(token) >= 4 {
+			suggestions = append(suggestions, "Reversed words aren't much harder to guess.")
+		}
+		if longest.l33t != "" {
+			suggestions = append(suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much.")
+		}
+		return warning, suggestions
+	case spatialPattern:
+		suggestions = append(suggestions, "Use a longer keyboard pattern with more turns.")
+		if longest.turns == 1 {
+			return "Straight rows of keys are easy to guess.", suggestions
+		}
+		return "Short keyboard patterns are easy to guess.", suggestions
+	case repeatPattern:
+		suggestions = append(suggestions, "Avoid repeated words and characters.")
+		if len([]rune(longest.baseToken)) == 1 {
+			return `Repeats like "aaa" are easy to guess.`, suggestions
+		}
+		return `Repeats like "abcabcabc" are only slightly harder to guess than "abc".`, suggestions
+	case sequencePattern:
+		return "Sequences like abc or 6543 are easy to guess.", append(suggestions, "Avoid sequences.")
+	case yearPattern:
+		return "Recent years are easy to guess.", append(suggestions, "Avoid recent years.", "Avoid years that are associated with you.")
+	case datePattern:
+		return "Dates are often easy to guess.", append(suggestions, "Avoid dates and years that are associated with you.")
+	}
+	return "", suggestions
+}
@@ -0,0 +1,683 @@
+package kittypass
+
+import (
+	_ "embed"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// The ranked frequency lists come from zxcvbn, https://github.com/dropbox/zxcvbn (MIT license).
+// Each line holds a single lowercase word, the most frequent first.
+var (
+	//go:embed common_passwords.txt
+	commonPasswordsList string
+	//go:embed english_words.txt
+	englishWordsList string
+	//go:embed surnames.txt
+	surnamesList string
+	//go:embed first_names.txt
+	firstNamesList string
+)
+
+type strengthPattern int
+
+const (
+	bruteforcePattern strengthPattern = iota
+	dictionaryPattern
+	spatialPattern
+	repeatPattern
+	sequencePattern
+	yearPattern
+	datePattern
+)
+
+// strengthMatch is a part of the password, from index i to j included, matching a guessable pattern.
+type strengthMatch struct {
+	pattern      strengthPattern
+	i, j         int
+	token        string
+	guessesLog10 float64
+
+	// dictionary matches
+	dictionary string
+	rank       int
+	reversed   bool
+	l33t       string
+	// spatial matches
+	turns int
+	// repeat matches
+	baseToken string
+}
+
+// rankedDictionaries maps every word of the frequency lists to its rank, per list.
+var rankedDictionaries = sync.OnceValue(func() map[string]map[string]int {
+	return map[string]map[string]int{
+		"passwords":   rankWords(strings.Split(commonPasswordsList, "\n")),
+		"english":     rankWords(strings.Split(englishWordsList, "\n")),
+		"surnames":    rankWords(strings.Split(surnamesList, "\n")),
+		"first names": rankWords(strings.Split(firstNamesList, "\n")),
+	}
+})
+
+func rankWords(words []string) map[string]int {
+	ranked := make(map[string]int, len(words))
+	for i, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if _, found := ranked[word]; word != "" && !found {
+			ranked[word] = i + 1
+		}
+	}
+	return ranked
+}
+
+// l33tTable lists the letters commonly replaced by each character.
+var l33tTable = map[rune][]rune{
+	'4': {'a'}, '@': {'a'},
+	'8': {'b'},
+	'(': {'c'}, '{': {'c'}, '[': {'c'}, '<': {'c'},
+	'3': {'e'},
+	'6': {'g'}, '9': {'g'},
+	'1': {'i', 'l'}, '!': {'i'}, '|': {'i', 'l'},
+	'0': {'o'},
+	'$': {'s'}, '5': {'s'},
+	'+': {'t'}, '7': {'t', 'l'},
+	'%': {'x'},
+	'2': {'z'},
+}
+
+func findMatches(password []rune, userInputs []string) []strengthMatch {
+	dictionaries := rankedDictionaries()
+	if len(userInputs) > 0 {
+		var inputs []string
+		for _, input := range userInputs {
+			inputs = append(inputs, strings.Fields(input)...)
+		}
+		dictionaries = copyDictionaries(dictionaries)
+		dictionaries["user inputs"] = rankWords(inputs)
+	}
+
+	var matches []strengthMatch
+	matches = append(matches, dictionaryMatches(password, dictionaries)...)
+	matches = append(matches, reversedDictionaryMatches(password, dictionaries)...)
+	matches = append(matches, l33tMatches(password, dictionaries)...)
+	matches = append(matches, spatialMatches(password)...)
+	matches = append(matches, repeatMatches(password, userInputs)...)
+	matches = append(matches, sequenceMatches(password)...)
+	matches = append(matches, yearMatches(password)...)
+	matches = append(matches, dateMatches(password)...)
+	return matches
+}
+
+func copyDictionaries(dictionaries map[string]map[string]int) map[string]map[string]int {
+	copied := make(map[string]map[string]int, len(dictionaries)+1)
+	for name, words := range dictionaries {
+		copied[name] = words
+	}
+	return copied
+}
+
+// dictionaryMatches finds every part of the password, of at least three characters, that is a word of the dictionaries.
+func dictionaryMatches(password []rune, dictionaries map[string]map[string]int) []strengthMatch {
+	lower := []rune(strings.ToLower(string(password)))
+	if len(lower) != len(password) {
+		lower = password
+	}
+	var matches []strengthMatch
+	for i := range password {
+		for j := i + 2; j < len(password); j++ {
+			word := string(lower[i : j+1])
+			for name, words := range dictionaries {
+				rank, found := words[word]
+				if !found {
+					continue
+				}
+				token := string(password[i : j+1])
+				guesses := math.Log10(float64(rank)) + math.Log10(uppercaseVariations(token))
+				matches = append(matches, strengthMatch{pattern: dictionaryPattern, i: i, j: j, token: token, guessesLog10: guesses, dictionary: name, rank: rank})
+			}
+		}
+	}
+	return matches
+}
+
+// reversedDictionaryMatches finds the words of the dictionaries written backwards in the password.
+func reversedDictionaryMatches(password []rune, dictionaries map[string]map[string]int) []strengthMatch {
+	n := len(password)
+	reversed := make([]rune, n)
+	for i, r := range password {
+		reversed[n-1-i] = r
+	}
+	var matches []strengthMatch
+	for _, m := range dictionaryMatches(reversed, dictionaries) {
+		token := []rune(m.token)
+		for a, b := 0, len(token)-1; a < b; a, b = a+1, b-1 {
+			token[a], token[b] = token[b], token[a]
+		}
+		m.i, m.j = n-1-m.j, n-1-m.i
+		m.token = string(token)
+		m.reversed = true
+		m.guessesLog10 += math.Log10(2)
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// l33tMatches finds the words of the dictionaries with letters replaced by look-alike digits or symbols.
+func l33tMatches(password []rune, dictionaries map[string]map[string]int) []strengthMatch {
+	var matches []strengthMatch
+	for _, substitution := range l33tSubstitutions(password) {
+		unleeted := make([]rune, len(password))
+		for i, r := range password {
+			if letter, found := substitution[r]; found {
+				unleeted[i] = letter
+			} else {
+				unleeted[i] = r
+			}
+		}
+		for _, m := range dictionaryMatches(unleeted, dictionaries) {
+			token := password[m.i : m.j+1]
+			used := map[rune]rune{}
+			for _, r := range token {
+				if letter, found := substitution[r]; found {
+					used[r] = letter
+				}
+			}
+			if len(used) == 0 {
+				continue
+			}
+			m.token = string(token)
+			m.guessesLog10 = math.Log10(float64(m.rank)) + math.Log10(uppercaseVariations(m.token)) + math.Log10(l33tVariations(token, used))
+			var subs []string
+			for r, letter := range used {
+				subs = append(subs, string(r)+" -> "+string(letter))
+			}
+			m.l33t = strings.Join(subs, ", ")
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// l33tSubstitutions returns the possible mappings of the l33t characters found in the password to letters, at most 16 of them.
+func l33tSubstitutions(password []rune) []map[rune]rune {
+	var present []rune
+	seen := map[rune]bool{}
+	for _, r := range password {
+		if _, found := l33tTable[r]; found && !seen[r] {
+			seen[r] = true
+			present = append(present, r)
+		}
+	}
+	if len(present) == 0 {
+		return nil
+	}
+	substitutions := []map[rune]rune{{}}
+	for _, r := range present {
+		var next []map[rune]rune
+		for _, substitution := range substitutions {
+			for _, letter := range l33tTable[r] {
+				extended := make(map[rune]rune, len(substitution)+1)
+				for k, v := range substitution {
+					extended[k] = v
+				}
+				extended[r] = letter
+				next = append(next, extended)
+				if len(next) >= 16 {
+					break
+				}
+			}
+		}
+		substitutions = next
+	}
+	return substitutions
+}
+
+// uppercaseVariations counts the ways of capitalizing a word an attacker tries, fewer for the usual capitalizations.
+func uppercaseVariations(token string) float64 {
+	upper, lower := 0, 0
+	runes := []rune(token)
+	for _, r := range runes {
+		if unicode.IsUpper(r) {
+			upper++
+		} else if unicode.IsLower(r) {
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	firstUpper := unicode.IsUpper(runes[0]) && upper == 1
+	lastUpper := unicode.IsUpper(runes[len(runes)-1]) && upper == 1
+	if firstUpper || lastUpper || lower == 0 {
+		return 2
+	}
+	variations := 0.0
+	for i := 1; i <= min(upper, lower); i++ {
+		variations += binomial(upper+lower, i)
+	}
+	return variations
+}
+
+// l33tVariations counts the ways of substituting the letters of a word an attacker tries.
+func l33tVariations(token []rune, used map[rune]rune) float64 {
+	variations := 1.0
+	for r, letter := range used {
+		substituted, unsubstituted := 0, 0
+		for _, c := range token {
+			if c == r {
+				substituted++
+			} else if unicode.ToLower(c) == letter {
+				unsubstituted++
+			}
+		}
+		if substituted == 0 || unsubstituted == 0 {
+			variations *= 2
+			continue
+		}
+		possibilities := 0.0
+		for i := 1; i <= min(substituted, unsubstituted); i++ {
+			possibilities += binomial(substituted+unsubstituted, i)
+		}
+		variations *= possibilities
+	}
+	return variations
+}
+
+func binomial(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+// keyboard is a keyboard layout, each row given as its unshifted and shifted characters. Rows are offset by half a key, as on a qwerty keyboard.
+type keyboard struct {
+	positions map[rune][2]int
+	shifted   map[rune]bool
+	slanted   bool
+	keys      int
+	degree    float64
+}
+
+var qwerty = newKeyboard(true, [][2]string{
+	{"`1234567890-=", "~!@#$%^&*()_+"},
+	{"qwertyuiop[]\\", "QWERTYUIOP{}|"},
+	{"asdfghjkl;'", "ASDFGHJKL:\""},
+	{"zxcvbnm,./", "ZXCVBNM<>?"},
+})
+
+var keypad = newKeyboard(false, [][2]string{
+	{"789", ""},
+	{"456", ""},
+	{"123", ""},
+	{"0", ""},
+})
+
+func newKeyboard(slanted bool, rows [][2]string) keyboard {
+	k := keyboard{positions: map[rune][2]int{}, shifted: map[rune]bool{}, slanted: slanted}
+	for r, row := range rows {
+		for c, char := range []rune(row[0]) {
+			k.positions[char] = [2]int{r, c}
+			k.keys++
+		}
+		for c, char := range []rune(row[1]) {
+			k.positions[char] = [2]int{r, c}
+			k.shifted[char] = true
+		}
+	}
+	// the average number of neighbours of a key weights the guesses of keyboard walks
+	occupied := map[[2]int]bool{}
+	for char, position := range k.positions {
+		if !k.shifted[char] {
+			occupied[position] = true
+		}
+	}
+	neighbours := 0
+	for position := range occupied {
+		for _, direction := range k.directions() {
+			if occupied[[2]int{position[0] + direction[0], position[1] + direction[1]}] {
+				neighbours++
+			}
+		}
+	}
+	k.degree = float64(neighbours) / float64(len(occupied))
+	return k
+}
+
+// directions lists the moves from a key to its neighbours.
+func (k keyboard) directions() [][2]int {
+	if k.slanted {
+		return [][2]int{{0, -1}, {0, 1}, {-1, 0}, {-1, 1}, {1, -1}, {1, 0}}
+	}
+	return [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}, {-1, -1}, {-1, 1}, {1, -1}, {1, 1}}
+}
+
+// direction returns the index of the move from a to b, or -1 when the keys are not neighbours.
+func (k keyboard) direction(a, b rune) int {
+	pa, foundA := k.positions[a]
+	pb, foundB := k.positions[b]
+	if !foundA || !foundB {
+		return -1
+	}
+	for i, direction := range k.directions() {
+		if pa[0]+direction[0] == pb[0] && pa[1]+direction[1] == pb[1] {
+			return i
+		}
+	}
+	return -1
+}
+
+// spatialMatches finds walks of at least three neighbouring keys on a qwerty keyboard or a numeric keypad.
+func spatialMatches(password []rune) []strengthMatch {
+	var matches []strengthMatch
+	for _, k := range []keyboard{qwerty, keypad} {
+		i := 0
+		for i < len(password)-2 {
+			j := i
+			turns, shifted := 0, 0
+			lastDirection := -1
+			if k.shifted[password[i]] {
+				shifted++
+			}
+			for j+1 < len(password) {
+				direction := k.direction(password[j], password[j+1])
+				if direction < 0 {
+					break
+				}
+				if direction != lastDirection {
+					turns++
+					lastDirection = direction
+				}
+				if k.shifted[password[j+1]] {
+					shifted++
+				}
+				j++
+			}
+			if j-i+1 >= 3 {
+				token := string(password[i : j+1])
+				guesses := spatialGuesses(k, j-i+1, turns, shifted)
+				matches = append(matches, strengthMatch{pattern: spatialPattern, i: i, j: j, token: token, guessesLog10: math.Log10(guesses), turns: turns})
+				i = j
+			} else {
+				i++
+			}
+		}
+	}
+	return matches
+}
+
+func spatialGuesses(k keyboard, length, turns, shifted int) float64 {
+	guesses := 0.0
+	for i := 2; i <= length; i++ {
+		for j := 1; j <= min(turns, i-1); j++ {
+			guesses += binomial(i-1, j-1) * float64(k.keys) * math.Pow(k.degree, float64(j))
+		}
+	}
+	if shifted > 0 {
+		unshifted := length - shifted
+		if unshifted == 0 {
+			guesses *= 2
+		} else {
+			variations := 0.0
+			for i := 1; i <= min(shifted, unshifted); i++ {
+				variations += binomial(shifted+unshifted, i)
+			}
+			guesses *= variations
+		}
+	}
+	return guesses
+}
+
+// repeatMatches finds parts of the password made of the same string repeated, such as "aaa" or "abcabc".
+// At each position the longest repeat is kept, made of its shortest repeated string.
+func repeatMatches(password []rune, userInputs []string) []strengthMatch {
+	var matches []strengthMatch
+	baseGuesses := map[string]float64{}
+	n := len(password)
+	i := 0
+	for i < n {
+		bestUnit, bestCount := 0, 0
+		for unit := 1; i+2*unit <= n; unit++ {
+			base := string(password[i : i+unit])
+			count := 1
+			for i+(count+1)*unit <= n && string(password[i+count*unit:i+(count+1)*unit]) == base {
+				count++
+			}
+			if count >= 2 && count*unit > bestCount*bestUnit {
+				bestUnit, bestCount = unit, count
+			}
+		}
+		length := bestUnit * bestCount
+		if length < 3 {
+			i++
+			continue
+		}
+		base := string(password[i : i+bestUnit])
+		guesses, found := baseGuesses[base]
+		if !found {
+			guesses, _ = mostGuessableSequence(password[i:i+bestUnit], userInputs)
+			baseGuesses[base] = guesses
+		}
+		matches = append(matches, strengthMatch{
+			pattern:      repeatPattern,
+			i:            i,
+			j:            i + length - 1,
+			token:        string(password[i : i+length]),
+			guessesLog10: guesses + math.Log10(float64(bestCount)),
+			baseToken:    base,
+		})
+		i += length
+	}
+	return matches
+}
+
+// sequenceMatches finds runs of characters following each other at a constant step, such as "abc", "7531" or "zyx".
+func sequenceMatches(password []rune) []strengthMatch {
+	var matches []strengthMatch
+	n := len(password)
+	i := 0
+	for i < n-2 {
+		delta := int(password[i+1]) - int(password[i])
+		if delta == 0 || delta > 5 || delta < -5 || sequenceClass(password[i]) != sequenceClass(password[i+1]) || sequenceClass(password[i]) == "" {
+			i++
+			continue
+		}
+		j := i + 1
+		for j+1 < n && int(password[j+1])-int(password[j]) == delta && sequenceClass(password[j+1]) == sequenceClass(password[i]) {
+			j++
+		}
+		if j-i+1 >= 3 {
+			first := password[i]
+			base := 26.0
+			switch {
+			case strings.ContainsRune("aAzZ019", first):
+				base = 4
+			case unicode.IsDigit(first):
+				base = 10
+			}
+			if delta < 0 {
+				base *= 2
+			}
+			matches = append(matches, strengthMatch{pattern: sequencePattern, i: i, j: j, token: string(password[i : j+1]), guessesLog10: math.Log10(base * float64(j-i+1))})
+			i = j
+		} else {
+			i++
+		}
+	}
+	return matches
+}
+
+func sequenceClass(r rune) string {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return "lower"
+	case r >= 'A' && r <= 'Z':
+		return "upper"
+	case r >= '0' && r <= '9':
+		return "digit"
+	}
+	return ""
+}
+
+// referenceYear is the year dates and years in passwords are compared to: recent years are guessed first.
+func referenceYear() int {
+	return time.Now().Year()
+}
+
+// yearGuesses counts the years an attacker tries before year, starting from recent ones.
+func yearGuesses(year int) float64 {
+	distance := year - referenceYear()
+	if distance < 0 {
+		distance = -distance
+	}
+	return float64(max(distance, 20))
+}
+
+// yearMatches finds years between 1900 and 2099 in the password.
+func yearMatches(password []rune) []strengthMatch {
+	var matches []strengthMatch
+	for i := 0; i+4 <= len(password); i++ {
+		token := string(password[i : i+4])
+		if !strings.HasPrefix(token, "19") && !strings.HasPrefix(token, "20") {
+			continue
+		}
+		year, err := strconv.Atoi(token)
+		if err != nil {
+			continue
+		}
+		matches = append(matches, strengthMatch{pattern: yearPattern, i: i, j: i + 3, token: token, guessesLog10: math.Log10(yearGuesses(year))})
+	}
+	return matches
+}
+
+// dateMatches finds dates of four to eight digits in the password, such as 1312, 13121998 or 13/12/98.
+func dateMatches(password []rune) []strengthMatch {
+	var matches []strengthMatch
+	n := len(password)
+	for i := 0; i < n; i++ {
+		for j := i + 3; j < n && j-i < 10; j++ {
+			token := string(password[i : j+1])
+			year, separated, found := parseDate(token)
+			if !found {
+				continue
+			}
+			guesses := 365 * yearGuesses(year)
+			if separated {
+				guesses *= 4
+			}
+			matches = append(matches, strengthMatch{pattern: datePattern, i: i, j: j, token: token, guessesLog10: math.Log10(guesses)})
+		}
+	}
+	return matches
+}
+
+// parseDate reports whether token is a date written as digits, with or without separators, and returns its year.
+// Dates without a year, such as 1312, are counted as recent.
+func parseDate(token string) (int, bool, bool) {
+	for _, separator := range []string{"/", "-", ".", "_", " "} {
+		if !strings.Contains(token, separator) {
+			continue
+		}
+		parts := strings.Split(token, separator)
+		if len(parts) != 3 {
+			return 0, false, false
+		}
+		var numbers []int
+		for _, part := range parts {
+			if len(part) < 1 || len(part) > 4 || !isDigits(part) {
+				return 0, false, false
+			}
+			number, _ := strconv.Atoi(part)
+			numbers = append(numbers, number)
+		}
+		year, found := validDate(numbers, []int{len(parts[0]), len(parts[1]), len(parts[2])})
+		return year, true, found
+	}
+
+	if !isDigits(token) || len(token) > 8 {
+		return 0, false, false
+	}
+	// try every split of the digits in day, month and year, or day and month
+	for a := 1; a < len(token); a++ {
+		for b := a + 1; b <= len(token); b++ {
+			parts := []string{token[:a], token[a:b], token[b:]}
+			if b == len(token) {
+				parts = parts[:2]
+			}
+			var numbers, lengths []int
+			valid := true
+			for _, part := range parts {
+				if len(part) > 4 {
+					valid = false
+					break
+				}
+				number, _ := strconv.Atoi(part)
+				numbers = append(numbers, number)
+				lengths = append(lengths, len(part))
+			}
+			if !valid {
+				continue
+			}
+			if len(numbers) == 2 {
+				if len(token) == 4 && isDayMonth(numbers[0], numbers[1]) {
+					return referenceYear(), false, true
+				}
+				continue
+			}
+			if year, found := validDate(numbers, lengths); found {
+				return year, false, true
+			}
+		}
+	}
+	return 0, false, false
+}
+
+// validDate finds a day, month and year among three numbers, the year being written first or last.
+func validDate(numbers, lengths []int) (int, bool) {
+	for _, order := range [][3]int{{2, 0, 1}, {0, 1, 2}} {
+		year, yearLength := numbers[order[0]], lengths[order[0]]
+		a, b := numbers[order[1]], numbers[order[2]]
+		if lengths[order[1]] > 2 || lengths[order[2]] > 2 {
+			continue
+		}
+		switch yearLength {
+		case 2:
+			if year > 50 {
+				year += 1900
+			} else {
+				year += 2000
+			}
+		case 4:
+			if year < 1000 || year > 2050 {
+				continue
+			}
+		default:
+			continue
+		}
+		if isDayMonth(a, b) || isDayMonth(b, a) {
+			return year, true
+		}
+	}
+	return 0, false
+}
+
+func isDayMonth(day, month int) bool {
+	return day >= 1 && day <= 31 && month >= 1 && month <= 12
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
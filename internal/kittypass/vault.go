@@ -2,28 +2,50 @@ package kittypass
 
 import (
 	"encoding/hex"
+	"fmt"
 	"log"
+	"strconv"
 
+	"github.com/google/uuid"
 	"github.com/mrtnhwtt/kittypass/internal/crypto"
 	"github.com/mrtnhwtt/kittypass/internal/storage"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// TODO: vault struct should hold the connection to the database
-// TODO: vault struct should hold the encryption algorithm used for that vault
 type Vault struct {
-	Uuid              string
-	Name              string
-	Description       string
-	Masterpass        string
+	// Storage is the backend holding the vault and its logins. It must be set before calling any method reading or writing the vault.
+	Storage     storage.Backend
+	Uuid        string
+	Name        string
+	Description string
+	// Cipher is the name of the encryption algorithm protecting the vault, chosen when the vault is created.
+	Cipher     string
+	Masterpass string
+	// HexKeyCheck is a known value encrypted under the DerivationKey, checking the master password without storing any hash of it.
+	HexKeyCheck string
+	// HexHashMasterpass is the bcrypt hash of the master password of vaults created before key check values existed.
+	// It is replaced by a key check value the first time the vault is unlocked.
 	HexHashMasterpass string
 	HexSalt           string
-	DerivationKey     []byte
-	Salt              []byte
+	HexWrappedKey     string
+	// MinEnvelopeVersion is the oldest ciphertext envelope version the vault decrypts. It is raised once every ciphertext of
+	// the vault is current, so that older ciphertexts put back in the database, such as from a backup, are refused.
+	MinEnvelopeVersion byte
+	// KDF are the Argon2id parameters deriving the DerivationKey from the master password.
+	KDF crypto.KDFParams
+	// DerivationKey is derived from the master password. It only wraps the DataKey.
+	DerivationKey []byte
+	// DataKey is the random key from which the login keys are derived. It is stored wrapped by the DerivationKey,
+	// so that changing the master password only re-wraps it instead of re-encrypting every login.
+	DataKey []byte
+	Salt    []byte
 }
 
 func NewVault() Vault {
-	return Vault{}
+	return Vault{
+		Cipher: crypto.AES,
+		KDF:    crypto.DefaultKDFParams,
+	}
 }
 
 // UseMasterPassword generate a DerivationKey from a master password to use to encrypt and decrypt passwords stored in kittypass
@@ -34,55 +56,80 @@ func (v *Vault) UseMasterPassword() error {
 		return err
 	}
 	v.HexSalt = hex.EncodeToString(v.Salt)
-	v.DerivationKey = crypto.GenerateKey([]byte(v.Masterpass), v.Salt)
+	v.DerivationKey = crypto.GenerateKey([]byte(v.Masterpass), v.Salt, v.KDF)
 	return nil
 }
 
 func (v *Vault) RecreateDerivationKey() error {
+	if err := v.deriveKey(); err != nil {
+		return err
+	}
+	return v.unwrapDataKey()
+}
+
+// deriveKey recreates the derivation key from the master password with the salt and key derivation parameters of the vault.
+func (v *Vault) deriveKey() error {
 	salt, err := hex.DecodeString(v.HexSalt)
 	if err != nil {
 		log.Printf("error when decoding salt: %s", err)
 		return MalformedDataError{Data: "salt"}
 	}
 	v.Salt = salt
-	v.DerivationKey = crypto.GenerateKey([]byte(v.Masterpass), v.Salt)
+	v.DerivationKey = crypto.GenerateKey([]byte(v.Masterpass), v.Salt, v.KDF)
 	return nil
 }
 
 func (v *Vault) CreateVault() error {
-	err := v.UseMasterPassword()
+	id, err := uuid.NewV7()
+	if err != nil {
+		return fmt.Errorf("error while generating an uuid for the vault: %s", err)
+	}
+	v.Uuid = id.String()
+	err = v.KDF.Validate()
 	if err != nil {
 		return err
 	}
-	err = v.HashMasterpass()
+	err = v.UseMasterPassword()
 	if err != nil {
 		return err
 	}
-	db, err := storage.New("./database.db")
+	v.DataKey, err = crypto.GenerateRandomKey()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-
-	_, err = db.SaveVault(v.Name, v.Description, v.HexHashMasterpass, v.HexSalt)
+	err = v.wrapDataKey()
 	if err != nil {
 		return err
 	}
-	return nil
-}
-
-func (v *Vault) HashMasterpass() error {
-	hashedMaster, err := bcrypt.GenerateFromPassword([]byte(v.Masterpass), 15)
+	err = v.createKeyCheck()
+	if err != nil {
+		return err
+	}
+	_, err = v.Storage.SaveVault(v.Uuid, v.Name, v.Description, v.Cipher, v.HexKeyCheck, v.HexSalt, v.HexWrappedKey, v.KDF.Time, v.KDF.Memory, v.KDF.Threads)
 	if err != nil {
 		return err
 	}
-	v.HexHashMasterpass = hex.EncodeToString(hashedMaster)
 	return nil
 }
 
 // Check the user provided master password against the one defined when creating the vault.
-// If they match, user can interact with logins in the vault. Returns an error when they do not match and nil when they match
+// If they match, user can interact with logins in the vault. Returns an error when they do not match and nil when they match.
+// The password is checked by decrypting the key check value under the derivation key, which is left recreated.
 func (v *Vault) MasterpassMatch() error {
+	if v.HexKeyCheck == "" {
+		return v.legacyMasterpassMatch()
+	}
+	if err := v.deriveKey(); err != nil {
+		return err
+	}
+	return v.verifyKeyCheck()
+}
+
+// legacyMasterpassMatch checks the master password of a vault created before key check values existed against its bcrypt hash.
+func (v *Vault) legacyMasterpassMatch() error {
+	if v.HexHashMasterpass == "" {
+		return MalformedDataError{"key check"}
+	}
 	storedPass, err := hex.DecodeString(v.HexHashMasterpass)
 	if err != nil {
 		log.Printf("error when decoding stored hex hashed password: %s", err)
@@ -95,20 +142,64 @@ func (v *Vault) MasterpassMatch() error {
 	return nil
 }
 
-func (v *Vault) Get() error {
-	db, err := storage.New("./database.db")
-	if err != nil {
+// Unlock checks the master password and recreates the derivation key and data key of the vault.
+// Vaults created before key check values existed get one in place of their bcrypt hash.
+func (v *Vault) Unlock() error {
+	if err := v.MasterpassMatch(); err != nil {
+		return err
+	}
+	if v.HexKeyCheck != "" {
+		return v.unwrapDataKey()
+	}
+	if err := v.RecreateDerivationKey(); err != nil {
 		return err
 	}
-	defer db.Close()
-	vaultData, err := db.GetVault(v.Name)
+	if err := v.createKeyCheck(); err != nil {
+		return err
+	}
+	if err := v.Storage.SaveKeyCheck(v.Uuid, v.HexKeyCheck); err != nil {
+		return err
+	}
+	v.HexHashMasterpass = ""
+	return nil
+}
+
+// UnlockWithKey unlocks the vault with a derivation key recreated earlier, such as one held by the agent, instead of the master password.
+// The key is checked against the key check value, so a key made stale by a master password change is rejected.
+func (v *Vault) UnlockWithKey(derivationKey []byte) error {
+	if v.HexKeyCheck == "" {
+		return IncorrectPasswordError{}
+	}
+	v.DerivationKey = derivationKey
+	if err := v.verifyKeyCheck(); err != nil {
+		v.DerivationKey = nil
+		return err
+	}
+	return v.unwrapDataKey()
+}
+
+func (v *Vault) Get() error {
+	vaultData, err := v.Storage.GetVault(v.Name)
 	if err != nil {
 		return err
 	}
 	v.Uuid = vaultData["uuid"]
 	v.Description = vaultData["description"]
+	v.Cipher = vaultData["cipher"]
+	v.HexKeyCheck = vaultData["hex_key_check"]
 	v.HexHashMasterpass = vaultData["hex_hashed_master_password"]
 	v.HexSalt = vaultData["hex_salt"]
+	v.HexWrappedKey = vaultData["hex_wrapped_key"]
+	v.KDF, err = parseKDFParams(vaultData)
+	if err != nil {
+		return err
+	}
+	minVersion, err := strconv.ParseUint(vaultData["min_envelope_version"], 10, 8)
+	if err != nil {
+		log.Printf("error when parsing minimum envelope version of vault %s: %s", v.Name, err)
+		return MalformedDataError{Data: "minimum envelope version"}
+	}
+	v.MinEnvelopeVersion = byte(minVersion)
 	v.Salt, err = hex.DecodeString(v.HexSalt)
 	if err != nil {
 		return err
@@ -117,12 +208,7 @@ func (v *Vault) Get() error {
 }
 
 func (v *Vault) List() ([]map[string]string, error) {
-	db, err := storage.New("./database.db")
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-	vaultList, err := db.ListVault(v.Name)
+	vaultList, err := v.Storage.ListVault(v.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -130,67 +216,155 @@ func (v *Vault) List() ([]map[string]string, error) {
 }
 
 func (v *Vault) Delete() (map[string]int64, error) {
-	db, err := storage.New("./database.db")
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-	deleted, err := db.DeleteVault(v.Name, v.Uuid)
+	deleted, err := v.Storage.DeleteVault(v.Name, v.Uuid)
 	if err != nil {
 		return nil, err
 	}
 	return deleted, nil
 }
 
+// Update changes the name, description or master password of the vault, ignoring empty values.
+// Changing the master password re-wraps the data key under the new derivation key, the logins are left untouched.
+// The vault must have been unlocked before changing the master password.
 func (v *Vault) Update(newMasterPass, newName, newDescription string) (map[string]int, error) {
-	var err error
-	var loginList []map[string]string
-	db, err := storage.New("./database.db")
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
+	var newSalt string
 	if newMasterPass != "" {
-		loginList, err = v.reencryptLogins(db, newMasterPass)
+		v.Masterpass = newMasterPass
+		err := v.UseMasterPassword()
 		if err != nil {
 			return nil, err
 		}
-
+		err = v.createKeyCheck()
+		if err != nil {
+			return nil, err
+		}
+		err = v.wrapDataKey()
+		if err != nil {
+			return nil, err
+		}
+		newSalt = v.HexSalt
 	}
-	return db.UpdateVault(v.Uuid, newName, newDescription, v.HexHashMasterpass, v.HexSalt, loginList)
+	return v.Storage.UpdateVault(v.Uuid, newName, newDescription, v.HexKeyCheck, newSalt, v.HexWrappedKey, v.KDF.Time, v.KDF.Memory, v.KDF.Threads)
+}
 
+// UpgradeKDF derives a new derivation key from the master password with stronger Argon2id parameters and a new salt, and re-wraps the data key under it.
+// The derivation key must have been recreated.
+func (v *Vault) UpgradeKDF(params crypto.KDFParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	if params.Weaker(v.KDF) {
+		return WeakerKDFParamsError{Current: v.KDF, Requested: params}
+	}
+	v.KDF = params
+	err := v.UseMasterPassword()
+	if err != nil {
+		return err
+	}
+	err = v.createKeyCheck()
+	if err != nil {
+		return err
+	}
+	err = v.wrapDataKey()
+	if err != nil {
+		return err
+	}
+	_, err = v.Storage.UpdateVault(v.Uuid, "", "", v.HexKeyCheck, v.HexSalt, v.HexWrappedKey, v.KDF.Time, v.KDF.Memory, v.KDF.Threads)
+	return err
 }
 
-func (v *Vault) reencryptLogins(db *storage.Storage, newMasterPass string) ([]map[string]string, error) {
-	// get all login and decrypt the passwords
-	e := crypto.New("aes")
-	loginList, err := db.ReadLogins(v.Uuid)
+// RotateKey replaces the data key of the vault with a new random key and re-encrypts every login under it.
+// When newCipher is not empty, the vault switches to that encryption algorithm for the new ciphertexts.
+// The derivation key must have been recreated. Returns the number of re-encrypted logins.
+func (v *Vault) RotateKey(newCipher string) (int, error) {
+	// get all login and decrypt the passwords with the current data key
+	loginList, err := v.Storage.ReadLogins(v.Uuid)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	for _, login := range loginList {
-		login["decrypted"], err = e.Decrypt(v.DerivationKey, login["hex_enc_pass"])
+		login["decrypted"], err = v.decryptPassword(login["name"], login["hex_enc_pass"], login["hex_salt"])
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
 	}
 
-	// create a new derivation key from the new password and encrypt login passwords
-	v.Masterpass = newMasterPass
-	err = v.UseMasterPassword()
+	// encrypt login passwords under a new data key, wrapped by the current derivation key
+	if newCipher != "" {
+		if _, err := crypto.New(newCipher); err != nil {
+			return 0, err
+		}
+		v.Cipher = newCipher
+	}
+	v.DataKey, err = crypto.GenerateRandomKey()
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	err = v.HashMasterpass()
+	err = v.wrapDataKey()
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	for _, login := range loginList {
-		login["newHexEncrypted"], err = e.Encrypt(v.DerivationKey, login["decrypted"])
+		login["newHexEncrypted"], login["newHexSalt"], err = v.encryptPassword(login["name"], login["decrypted"])
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
 		delete(login, "decrypted")
 	}
-	return loginList, nil
+	return v.Storage.RotateVaultKey(v.Uuid, v.Cipher, v.HexWrappedKey, loginList)
+}
+
+// UpgradeLogins re-encrypts the logins stored before per-login salts or ciphertext envelopes existed with their own salt and key.
+// Once every ciphertext of the vault is current, the vault stops accepting older ones.
+// The vault derivation key must have been recreated. Returns the number of upgraded logins.
+func (v *Vault) UpgradeLogins() (int, error) {
+	if v.MinEnvelopeVersion >= crypto.EnvelopeVersion {
+		return 0, nil
+	}
+	loginList, err := v.Storage.ReadLogins(v.Uuid)
+	if err != nil {
+		return 0, err
+	}
+	var legacy []map[string]string
+	for _, login := range loginList {
+		if login["hex_salt"] != "" && crypto.IsCurrent(login["hex_enc_pass"]) {
+			continue
+		}
+		decrypted, err := v.decryptPassword(login["name"], login["hex_enc_pass"], login["hex_salt"])
+		if err != nil {
+			return 0, err
+		}
+		login["newHexEncrypted"], login["newHexSalt"], err = v.encryptPassword(login["name"], decrypted)
+		if err != nil {
+			return 0, err
+		}
+		legacy = append(legacy, login)
+	}
+	upgraded := 0
+	if len(legacy) > 0 {
+		upgraded, err = v.Storage.ReencryptLogins(v.Uuid, legacy)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return upgraded, v.requireCurrentEnvelopes()
+}
+
+func parseKDFParams(vaultData map[string]string) (crypto.KDFParams, error) {
+	kdfTime, err := strconv.ParseUint(vaultData["kdf_time"], 10, 32)
+	if err != nil {
+		log.Printf("error when parsing kdf time: %s", err)
+		return crypto.KDFParams{}, MalformedDataError{Data: "kdf time"}
+	}
+	kdfMemory, err := strconv.ParseUint(vaultData["kdf_memory"], 10, 32)
+	if err != nil {
+		log.Printf("error when parsing kdf memory: %s", err)
+		return crypto.KDFParams{}, MalformedDataError{Data: "kdf memory"}
+	}
+	kdfThreads, err := strconv.ParseUint(vaultData["kdf_threads"], 10, 8)
+	if err != nil {
+		log.Printf("error when parsing kdf threads: %s", err)
+		return crypto.KDFParams{}, MalformedDataError{Data: "kdf threads"}
+	}
+	return crypto.KDFParams{Time: uint32(kdfTime), Memory: uint32(kdfMemory), Threads: uint8(kdfThreads)}, nil
 }
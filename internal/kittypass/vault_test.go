@@ -0,0 +1,196 @@
+package kittypass
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrtnhwtt/kittypass/internal/crypto"
+	"github.com/mrtnhwtt/kittypass/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testKDF keeps the key derivation of test vaults cheap.
+var testKDF = crypto.KDFParams{Time: 1, Memory: 64, Threads: 1}
+
+// newTestVault creates a vault holding one login in a new database, and returns the vault and the path of the database.
+func newTestVault(t *testing.T) (Vault, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "kittypass.db")
+	db, err := storage.New(path)
+	if err != nil {
+		t.Fatalf("storage.New() failed: %s", err)
+	}
+	t.Cleanup(db.Close)
+
+	vault := Vault{Storage: db, Name: "test", Cipher: crypto.AES, KDF: testKDF, Masterpass: "master password"}
+	if err := vault.CreateVault(); err != nil {
+		t.Fatalf("CreateVault() failed: %s", err)
+	}
+	login := Login{Vault: &vault, Name: "github", Username: "martin", Password: "login password"}
+	if err := login.Add(); err != nil {
+		t.Fatalf("Add() failed: %s", err)
+	}
+	return vault, path
+}
+
+// openTestVault reads the vault back from its database and unlocks it with its master password, as commands do.
+func openTestVault(db storage.Backend, name, masterpass string) (Vault, error) {
+	vault := Vault{Storage: db, Name: name, Masterpass: masterpass}
+	if err := vault.Get(); err != nil {
+		return vault, err
+	}
+	if err := vault.Unlock(); err != nil {
+		return vault, err
+	}
+	_, err := vault.UpgradeLogins()
+	return vault, err
+}
+
+func TestUnlockRefusesLoweredMinEnvelopeVersion(t *testing.T) {
+	created, path := newTestVault(t)
+	vault, err := openTestVault(created.Storage, created.Name, created.Masterpass)
+	if err != nil {
+		t.Fatalf("opening the vault failed: %s", err)
+	}
+	if vault.MinEnvelopeVersion != crypto.EnvelopeVersion {
+		t.Fatalf("minimum envelope version is %d after opening the vault, expected %d", vault.MinEnvelopeVersion, crypto.EnvelopeVersion)
+	}
+	if _, err := openTestVault(created.Storage, created.Name, created.Masterpass); err != nil {
+		t.Fatalf("opening the vault again failed: %s", err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("opening the database failed: %s", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`UPDATE vaults SET min_envelope_version = 0 WHERE uuid = ?`, vault.Uuid); err != nil {
+		t.Fatalf("lowering the minimum envelope version failed: %s", err)
+	}
+
+	_, err = openTestVault(created.Storage, created.Name, created.Masterpass)
+	if !errors.As(err, new(IncorrectPasswordError)) {
+		t.Fatalf("opening the vault with a lowered minimum envelope version returned %v, expected an IncorrectPasswordError", err)
+	}
+	withKey := Vault{Storage: created.Storage, Name: created.Name}
+	if err := withKey.Get(); err != nil {
+		t.Fatalf("Get() failed: %s", err)
+	}
+	if err := withKey.UnlockWithKey(vault.DerivationKey); !errors.As(err, new(IncorrectPasswordError)) {
+		t.Fatalf("UnlockWithKey() with a lowered minimum envelope version returned %v, expected an IncorrectPasswordError", err)
+	}
+}
+
+// baselineSchema is the schema of databases created before schema versioning existed.
+const baselineSchema = `CREATE TABLE vaults (
+	uuid TEXT PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL,
+	hex_hashed_master_password TEXT NOT NULL,
+	hex_salt TEXT NOT NULL,
+	date_created DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE passwords (
+	identifier TEXT NOT NULL UNIQUE,
+	vault_uuid TEXT NOT NULL,
+	name TEXT NOT NULL,
+	username TEXT NOT NULL,
+	hex_encrypted_password TEXT NOT NULL,
+	date_created DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(vault_uuid) REFERENCES vaults(uuid)
+);`
+
+// createBaselineDatabase creates a database in the baseline schema holding a vault checked by the bcrypt hash of its
+// master password, and a login encrypted under its derivation key in the legacy format.
+func createBaselineDatabase(t *testing.T, path, masterpass, loginPassword string) {
+	t.Helper()
+	const vaultUuid = "0192a7d4-5d3e-7c1a-9f00-000000000001"
+	hash, err := bcrypt.GenerateFromPassword([]byte(masterpass), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hashing the master password failed: %s", err)
+	}
+	salt := []byte("0123456789abcdef")
+	key := crypto.GenerateKey([]byte(masterpass), salt, crypto.DefaultKDFParams)
+	nonce := make([]byte, crypto.Aes{}.NonceSize())
+	sealed, err := crypto.Aes{}.Seal(key, nonce, []byte(loginPassword), nil)
+	if err != nil {
+		t.Fatalf("encrypting the login password failed: %s", err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("opening the database failed: %s", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(baselineSchema); err != nil {
+		t.Fatalf("creating the baseline schema failed: %s", err)
+	}
+	if _, err := db.Exec(`INSERT INTO vaults (uuid, name, description, hex_hashed_master_password, hex_salt) VALUES (?, 'old', '', ?, ?)`,
+		vaultUuid, hex.EncodeToString(hash), hex.EncodeToString(salt)); err != nil {
+		t.Fatalf("inserting the vault failed: %s", err)
+	}
+	if _, err := db.Exec(`INSERT INTO passwords (identifier, vault_uuid, name, username, hex_encrypted_password) VALUES (?, ?, 'github', 'martin', ?)`,
+		storage.LoginIdentifier(vaultUuid, "github"), vaultUuid, hex.EncodeToString(append(nonce, sealed...))); err != nil {
+		t.Fatalf("inserting the login failed: %s", err)
+	}
+}
+
+func TestUnlockReplacesLegacyMasterHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kittypass.db")
+	createBaselineDatabase(t, path, "master password", "login password")
+	db, err := storage.New(path)
+	if err != nil {
+		t.Fatalf("storage.New() failed: %s", err)
+	}
+	defer db.Close()
+	backups, err := filepath.Glob(path + ".v0-*.bak")
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("found backups %v (%v), expected a single backup taken before migrating", backups, err)
+	}
+
+	if _, err := openTestVault(db, "old", "wrong password"); !errors.As(err, new(IncorrectPasswordError)) {
+		t.Fatalf("opening the legacy vault with a wrong password returned %v, expected an IncorrectPasswordError", err)
+	}
+	vault, err := openTestVault(db, "old", "master password")
+	if err != nil {
+		t.Fatalf("opening the legacy vault failed: %s", err)
+	}
+	if vault.HexKeyCheck == "" || vault.HexHashMasterpass != "" {
+		t.Fatalf("legacy vault has key check %q and master password hash %q, expected only a key check", vault.HexKeyCheck, vault.HexHashMasterpass)
+	}
+
+	stored, err := db.GetVault("old")
+	if err != nil {
+		t.Fatalf("GetVault() failed: %s", err)
+	}
+	if stored["hex_key_check"] == "" || stored["hex_hashed_master_password"] != "" {
+		t.Fatalf("stored vault has key check %q and master password hash %q, expected only a key check", stored["hex_key_check"], stored["hex_hashed_master_password"])
+	}
+	logins, err := db.ReadLogins(vault.Uuid)
+	if err != nil {
+		t.Fatalf("ReadLogins() failed: %s", err)
+	}
+	if len(logins) != 1 || logins[0]["hex_salt"] == "" || !crypto.IsCurrent(logins[0]["hex_enc_pass"]) {
+		t.Fatalf("stored logins are %v, expected a single login upgraded to the current format", logins)
+	}
+
+	// the vault is now checked by its key check value
+	if _, err := openTestVault(db, "old", "wrong password"); !errors.As(err, new(IncorrectPasswordError)) {
+		t.Fatalf("opening the converted vault with a wrong password returned %v, expected an IncorrectPasswordError", err)
+	}
+	vault, err = openTestVault(db, "old", "master password")
+	if err != nil {
+		t.Fatalf("opening the converted vault failed: %s", err)
+	}
+	login := Login{Vault: &vault, Name: "github"}
+	decrypted, err := login.Get()
+	if err != nil {
+		t.Fatalf("reading the login failed: %s", err)
+	}
+	if decrypted["password"] != "login password" {
+		t.Fatalf("login has password %q, expected %q", decrypted["password"], "login password")
+	}
+}
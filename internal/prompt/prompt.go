@@ -8,19 +8,33 @@ import (
     "golang.org/x/term"
 )
 
+type NotATerminalError struct{}
+
+func (e NotATerminalError) Error() string {
+    return "cannot prompt for a password, standard input is not a terminal"
+}
+
 // PasswordPrompt asks for a string value using the label.
 // The entered value will not be displayed on the screen
-// while typing.
-func PasswordPrompt(label string) string {
+// while typing. It fails when standard input is not a terminal.
+func PasswordPrompt(label string) (string, error) {
+    fd := int(syscall.Stdin)
+    if !term.IsTerminal(fd) {
+        return "", NotATerminalError{}
+    }
     var s string
     fmt.Fprint(os.Stderr, label+" ")
     for {
-        b, _ := term.ReadPassword(int(syscall.Stdin))
+        b, err := term.ReadPassword(fd)
+        if err != nil {
+            fmt.Fprintln(os.Stderr)
+            return "", err
+        }
         s = string(b)
         if s != "" {
             break
         }
     }
     fmt.Print("\r\033[K")
-    return s
-}
\ No newline at end of file
+    return s, nil
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"log"
+	"strings"
+)
+
+// Backend is the set of operations kittypass needs from a store of vaults and logins.
+// Storage, backed by SQLite, is the default implementation.
+type Backend interface {
+	SaveVault(uuid, name, description, cipher, hexKeyCheck, hexSalt, hexWrappedKey string, kdfTime, kdfMemory uint32, kdfThreads uint8) (int64, error)
+	GetVault(name string) (map[string]string, error)
+	ListVault(name string) ([]map[string]string, error)
+	UpdateVault(vaultUuid, newName, newDescription, newKeyCheck, newSalt, newWrappedKey string, kdfTime, kdfMemory uint32, kdfThreads uint8) (map[string]int, error)
+	SaveKeyCheck(vaultUuid, hexKeyCheck string) error
+	RaiseMinEnvelopeVersion(vaultUuid, hexKeyCheck, hexWrappedKey string, version int) error
+	DeleteVault(name, vault_uuid string) (map[string]int64, error)
+
+	SaveLogin(vaultUuid, name, username, hexEncryptedPassword, hexSalt, policy string) (int64, error)
+	SaveLogins(vaultUuid string, loginList []map[string]string) (int, error)
+	ReadLogin(vault_uuid, name string) (map[string]string, error)
+	ReadLogins(vault_uuid string) ([]map[string]string, error)
+	ReencryptLogins(vaultUuid string, loginList []map[string]string) (int, error)
+	RotateVaultKey(vaultUuid, cipher, newWrappedKey string, loginList []map[string]string) (int, error)
+	ListLogin(vault_uuid, name, username string) ([]map[string]string, error)
+	UpdateLogin(vaultUuid, target, name, username, hexEncryptedPassword, hexSalt, policy string, passwordChanged bool) (int64, error)
+	DeleteLogin(vault_uuid, name string) error
+
+	SavePolicy(name, options string) (int64, error)
+	GetPolicy(name string) (map[string]string, error)
+	ListPolicy() ([]map[string]string, error)
+	DeletePolicy(name string) error
+
+	ExportVault(name string) (map[string]string, []map[string]string, error)
+	ImportVault(vault map[string]string, loginList []map[string]string) error
+
+	Close()
+}
+
+var _ Backend = (*Storage)(nil)
+
+// Open opens the backend described by uri. Supported forms are a plain file path or sqlite://<path>, both opening a SQLite database.
+func Open(uri string) (Backend, error) {
+	scheme, path, found := strings.Cut(uri, "://")
+	if !found {
+		return New(uri)
+	}
+	switch scheme {
+	case "sqlite", "sqlite3":
+		return New(path)
+	default:
+		log.Printf("unsupported storage backend scheme %s in uri %s", scheme, uri)
+		return nil, UnsupportedBackendError{Scheme: scheme}
+	}
+}
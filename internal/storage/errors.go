@@ -46,3 +46,53 @@ type LoginNotFound struct{}
 func (e LoginNotFound) Error() string {
 	return "login not found"
 }
+
+type SchemaTooNewError struct {
+	Version   int
+	Supported int
+}
+
+func (e SchemaTooNewError) Error() string {
+	return fmt.Sprintf("database schema version %d is newer than the supported version %d, please upgrade kittypass", e.Version, e.Supported)
+}
+
+type StorageMigrationError struct {
+	Version int
+}
+
+func (e StorageMigrationError) Error() string {
+	return fmt.Sprintf("failed to migrate storage to schema version %d. Changes were not saved", e.Version)
+}
+
+type StorageBackupError struct {
+	Path string
+}
+
+func (e StorageBackupError) Error() string {
+	return fmt.Sprintf("failed to backup storage to %s before migrating", e.Path)
+}
+
+type UnsupportedBackendError struct {
+	Scheme string
+}
+
+func (e UnsupportedBackendError) Error() string {
+	return fmt.Sprintf("unsupported storage backend %s", e.Scheme)
+}
+
+type PolicyNotFound struct {
+	Name string
+}
+
+func (e PolicyNotFound) Error() string {
+	return fmt.Sprintf("password policy %s not found", e.Name)
+}
+
+type PolicyInUseError struct {
+	Name   string
+	Logins int
+}
+
+func (e PolicyInUseError) Error() string {
+	return fmt.Sprintf("password policy %s is used by %d logins", e.Name, e.Logins)
+}
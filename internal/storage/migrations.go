@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// migration upgrades the schema of the database to its version. Migrations are applied in order, each one in its own transaction.
+type migration struct {
+	version     int
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// migrations lists every schema change since the first release. Only append to this list: a released migration must never be edited.
+var migrations = []migration{
+	{version: 1, description: "create vaults and passwords tables", up: createTables},
+	{version: 2, description: "add per-login salt to passwords", up: addLoginSalt},
+	{version: 3, description: "add wrapped data key to vaults", up: addWrappedKey},
+	{version: 4, description: "add encryption algorithm to vaults", up: addVaultCipher},
+	{version: 5, description: "add key derivation parameters to vaults", up: addKDFParams},
+	{version: 6, description: "replace bcrypt master password hash with a key check value", up: replaceMasterHash},
+	{version: 7, description: "add password policies", up: addPolicies},
+	{version: 8, description: "add date of the last password change to passwords", up: addPasswordChangeDate},
+	{version: 9, description: "add minimum ciphertext envelope version to vaults", up: addMinEnvelopeVersion},
+}
+
+// schemaVersion returns the version this binary upgrades databases to.
+func schemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// migrate brings the database up to date with the schema of this binary.
+// A backup copy of an existing database is taken next to it before any migration is applied.
+func (s *Storage) migrate(databasePath string) error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		date_applied DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`)
+	if err != nil {
+		log.Printf("error when running create query for schema_version table: %s", err)
+		return StorageInitError{}
+	}
+
+	current, err := s.currentVersion()
+	if err != nil {
+		return err
+	}
+	if current > schemaVersion() {
+		log.Printf("database at %s has schema version %d, this binary supports up to version %d", databasePath, current, schemaVersion())
+		return SchemaTooNewError{Version: current, Supported: schemaVersion()}
+	}
+	if current == schemaVersion() {
+		return nil
+	}
+
+	populated, err := s.populated()
+	if err != nil {
+		return err
+	}
+	if populated {
+		if err := s.backup(databasePath, current); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := s.apply(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) currentVersion() (int, error) {
+	var version int
+	err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	if err != nil {
+		log.Printf("failed to read the schema version of the database: %s", err)
+		return 0, StorageReadError{}
+	}
+	return version, nil
+}
+
+// populated reports whether the database holds kittypass tables, including databases created before schema versioning existed.
+func (s *Storage) populated() (bool, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('vaults', 'passwords')`).Scan(&count)
+	if err != nil {
+		log.Printf("failed to list the tables of the database: %s", err)
+		return false, StorageReadError{}
+	}
+	return count > 0, nil
+}
+
+func (s *Storage) backup(databasePath string, version int) error {
+	if databasePath == ":memory:" {
+		return nil
+	}
+	backupPath := fmt.Sprintf("%s.v%d-%s.bak", databasePath, version, time.Now().Format("20060102150405"))
+	// VACUUM INTO writes into an existing empty file, keeping its permissions
+	if err := createPrivateFile(backupPath); err != nil {
+		log.Printf("failed to create backup file %s before migrating: %s", backupPath, err)
+		return StorageBackupError{Path: backupPath}
+	}
+	if _, err := s.db.Exec(`VACUUM INTO ?`, backupPath); err != nil {
+		log.Printf("failed to backup database to %s before migrating: %s", backupPath, err)
+		return StorageBackupError{Path: backupPath}
+	}
+	log.Printf("database backed up to %s before migrating from schema version %d", backupPath, version)
+	return nil
+}
+
+func (s *Storage) apply(m migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("failed to begin transaction: %s", err)
+		return StorageMigrationError{Version: m.version}
+	}
+	if err = m.up(tx); err != nil {
+		log.Printf("failed to apply migration %d (%s): %s", m.version, m.description, err)
+		tx.Rollback()
+		return StorageMigrationError{Version: m.version}
+	}
+	if _, err = tx.Exec(`INSERT INTO schema_version (version, description) VALUES (?, ?)`, m.version, m.description); err != nil {
+		log.Printf("failed to record migration %d: %s", m.version, err)
+		tx.Rollback()
+		return StorageMigrationError{Version: m.version}
+	}
+	if err = tx.Commit(); err != nil {
+		log.Printf("failed to commit migration %d: %s", m.version, err)
+		return StorageMigrationError{Version: m.version}
+	}
+	log.Printf("applied migration %d: %s", m.version, m.description)
+	return nil
+}
+
+func createTables(tx *sql.Tx) error {
+	vaultsQuery := `CREATE TABLE IF NOT EXISTS vaults (
+        uuid TEXT PRIMARY KEY,
+        name TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL,
+        hex_hashed_master_password TEXT NOT NULL,
+		hex_salt TEXT NOT NULL,
+        date_created DATETIME DEFAULT CURRENT_TIMESTAMP
+    );`
+	if _, err := tx.Exec(vaultsQuery); err != nil {
+		return fmt.Errorf("error when running create query for vaults table: %s", err)
+	}
+
+	passwordsQuery := `CREATE TABLE IF NOT EXISTS passwords ( 
+		identifier TEXT NOT NULL UNIQUE,
+        vault_uuid TEXT NOT NULL,
+        name TEXT NOT NULL,
+        username TEXT NOT NULL,
+        hex_encrypted_password TEXT NOT NULL,
+        date_created DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY(vault_uuid) REFERENCES vaults(uuid)
+    );`
+	if _, err := tx.Exec(passwordsQuery); err != nil {
+		return fmt.Errorf("error when running create query for passwords table: %s", err)
+	}
+	return nil
+}
+
+func addLoginSalt(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE passwords ADD COLUMN hex_salt TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+func addWrappedKey(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE vaults ADD COLUMN hex_wrapped_key TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+func addVaultCipher(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE vaults ADD COLUMN cipher TEXT NOT NULL DEFAULT 'aes'`)
+	return err
+}
+
+func addKDFParams(tx *sql.Tx) error {
+	for _, query := range []string{
+		`ALTER TABLE vaults ADD COLUMN kdf_time INTEGER NOT NULL DEFAULT 1`,
+		`ALTER TABLE vaults ADD COLUMN kdf_memory INTEGER NOT NULL DEFAULT 65536`,
+		`ALTER TABLE vaults ADD COLUMN kdf_threads INTEGER NOT NULL DEFAULT 4`,
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceMasterHash drops the bcrypt hash of the master password from the vaults. Hashes of existing vaults are moved to
+// the legacy_verifiers table, so that the master password can still be checked once and a key check value saved in its place.
+func replaceMasterHash(tx *sql.Tx) error {
+	for _, query := range []string{
+		`ALTER TABLE vaults ADD COLUMN hex_key_check TEXT NOT NULL DEFAULT ''`,
+		`CREATE TABLE IF NOT EXISTS legacy_verifiers (
+			vault_uuid TEXT PRIMARY KEY,
+			hex_hashed_master_password TEXT NOT NULL,
+			FOREIGN KEY(vault_uuid) REFERENCES vaults(uuid)
+		)`,
+		`INSERT INTO legacy_verifiers (vault_uuid, hex_hashed_master_password)
+			SELECT uuid, hex_hashed_master_password FROM vaults WHERE hex_hashed_master_password != ''`,
+		`ALTER TABLE vaults DROP COLUMN hex_hashed_master_password`,
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addPolicies(tx *sql.Tx) error {
+	for _, query := range []string{
+		`CREATE TABLE IF NOT EXISTS policies (
+			name TEXT PRIMARY KEY,
+			options TEXT NOT NULL,
+			date_created DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE passwords ADD COLUMN policy TEXT NOT NULL DEFAULT ''`,
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addPasswordChangeDate(tx *sql.Tx) error {
+	for _, query := range []string{
+		`ALTER TABLE passwords ADD COLUMN date_password_changed DATETIME`,
+		`UPDATE passwords SET date_password_changed = date_created`,
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addMinEnvelopeVersion(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE vaults ADD COLUMN min_envelope_version INTEGER NOT NULL DEFAULT 0`)
+	return err
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixtureVault is the vault of fixture databases, in the schema of their version.
+var fixtureVault = map[string]string{
+	"uuid":                       "0192a7d4-5d3e-7c1a-9f00-000000000001",
+	"name":                       "old",
+	"description":                "created by an older version",
+	"hex_hashed_master_password": "2432612431302468617368",
+	"hex_salt":                   "00112233445566778899aabbccddeeff",
+}
+
+// fixtureLogins are the logins of fixture databases, in the schema of their version.
+var fixtureLogins = []map[string]string{
+	{"identifier": fixtureVault["uuid"] + "_github", "vault_uuid": fixtureVault["uuid"], "name": "github", "username": "martin", "hex_encrypted_password": "aabbcc"},
+	{"identifier": fixtureVault["uuid"] + "_email", "vault_uuid": fixtureVault["uuid"], "name": "email", "username": "martin@example.com", "hex_encrypted_password": "ddeeff"},
+}
+
+// createFixture creates a database at path in the schema of the given version, holding fixtureVault and fixtureLogins.
+// Version 0 is the schema of databases created before schema versioning existed.
+func createFixture(t *testing.T, path string, version int) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("opening the fixture database failed: %s", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("beginning a transaction failed: %s", err)
+	}
+	if err := createTables(tx); err != nil {
+		t.Fatalf("creating the tables failed: %s", err)
+	}
+	if err := insertRow(tx, "vaults", fixtureVault); err != nil {
+		t.Fatalf("inserting the vault failed: %s", err)
+	}
+	for _, login := range fixtureLogins {
+		if err := insertRow(tx, "passwords", login); err != nil {
+			t.Fatalf("inserting a login failed: %s", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("committing the fixture failed: %s", err)
+	}
+
+	if version == 0 {
+		return
+	}
+	if _, err := db.Exec(`CREATE TABLE schema_version (version INTEGER PRIMARY KEY, description TEXT NOT NULL, date_applied DATETIME DEFAULT CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatalf("creating the schema_version table failed: %s", err)
+	}
+	s := &Storage{db: db}
+	for _, m := range migrations[:version] {
+		if err := s.apply(m); err != nil {
+			t.Fatalf("applying migration %d failed: %s", m.version, err)
+		}
+	}
+}
+
+// checkMigratedFixture checks that the fixture database opened as s was brought up to the current schema with its data intact.
+func checkMigratedFixture(t *testing.T, s *Storage) {
+	t.Helper()
+	version, err := s.currentVersion()
+	if err != nil {
+		t.Fatalf("currentVersion() failed: %s", err)
+	}
+	if version != schemaVersion() {
+		t.Fatalf("database has schema version %d after migrating, expected %d", version, schemaVersion())
+	}
+
+	vault, err := s.GetVault(fixtureVault["name"])
+	if err != nil {
+		t.Fatalf("GetVault() failed: %s", err)
+	}
+	expected := map[string]string{
+		"uuid":                       fixtureVault["uuid"],
+		"description":                fixtureVault["description"],
+		"hex_salt":                   fixtureVault["hex_salt"],
+		"hex_hashed_master_password": fixtureVault["hex_hashed_master_password"],
+		"hex_key_check":              "",
+		"hex_wrapped_key":            "",
+		"cipher":                     "aes",
+		"kdf_time":                   "1",
+		"kdf_memory":                 "65536",
+		"kdf_threads":                "4",
+		"min_envelope_version":       "0",
+	}
+	for column, value := range expected {
+		if vault[column] != value {
+			t.Errorf("migrated vault has %s %q, expected %q", column, vault[column], value)
+		}
+	}
+
+	logins, err := s.ReadLogins(fixtureVault["uuid"])
+	if err != nil {
+		t.Fatalf("ReadLogins() failed: %s", err)
+	}
+	if len(logins) != len(fixtureLogins) {
+		t.Fatalf("migrated vault has %d logins, expected %d", len(logins), len(fixtureLogins))
+	}
+	for _, login := range logins {
+		var fixture map[string]string
+		for _, candidate := range fixtureLogins {
+			if candidate["identifier"] == login["identifier"] {
+				fixture = candidate
+			}
+		}
+		if fixture == nil {
+			t.Fatalf("migrated vault has unexpected login %s", login["identifier"])
+		}
+		if login["hex_enc_pass"] != fixture["hex_encrypted_password"] || login["username"] != fixture["username"] || login["hex_salt"] != "" {
+			t.Errorf("migrated login %s is %v, expected the fixture %v without salt", login["identifier"], login, fixture)
+		}
+		if login["date_password_changed"] == "" {
+			t.Errorf("migrated login %s has no date of the last password change", login["identifier"])
+		}
+	}
+}
+
+func TestMigrateFromVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kittypass.db")
+	createFixture(t, path, 1)
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	checkMigratedFixture(t, s)
+	s.Close()
+
+	// opening an up to date database applies nothing
+	s, err = New(path)
+	if err != nil {
+		t.Fatalf("New() failed on an up to date database: %s", err)
+	}
+	defer s.Close()
+	checkMigratedFixture(t, s)
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kittypass.db")
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	_, err = s.db.Exec(`INSERT INTO schema_version (version, description) VALUES (?, 'from a newer binary')`, schemaVersion()+1)
+	s.Close()
+	if err != nil {
+		t.Fatalf("recording a newer schema version failed: %s", err)
+	}
+
+	_, err = New(path)
+	tooNew, ok := err.(SchemaTooNewError)
+	if !ok {
+		t.Fatalf("New() returned %v, expected a SchemaTooNewError", err)
+	}
+	if tooNew.Version != schemaVersion()+1 || tooNew.Supported != schemaVersion() {
+		t.Fatalf("New() returned %+v, expected version %d above %d", tooNew, schemaVersion()+1, schemaVersion())
+	}
+}
+
+func TestMigrateBaselineDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kittypass.db")
+	createFixture(t, path, 0)
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	defer s.Close()
+	checkMigratedFixture(t, s)
+
+	backups, err := filepath.Glob(path + ".v0-*.bak")
+	if err != nil {
+		t.Fatalf("listing backups failed: %s", err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("found backups %v, expected a single backup of the baseline database", backups)
+	}
+	for _, file := range []string{path, backups[0]} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("reading the permissions of %s failed: %s", file, err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("%s has permissions %o, expected 600", file, perm)
+		}
+	}
+
+	// the backup is the database as it was before migrating
+	backup, err := sql.Open("sqlite3", backups[0])
+	if err != nil {
+		t.Fatalf("opening the backup failed: %s", err)
+	}
+	defer backup.Close()
+	var hash string
+	if err := backup.QueryRow(`SELECT hex_hashed_master_password FROM vaults WHERE uuid = ?`, fixtureVault["uuid"]).Scan(&hash); err != nil {
+		t.Fatalf("reading the vault from the backup failed: %s", err)
+	}
+	if hash != fixtureVault["hex_hashed_master_password"] {
+		t.Errorf("backup holds master password hash %q, expected %q", hash, fixtureVault["hex_hashed_master_password"])
+	}
+	var logins, versions int
+	if err := backup.QueryRow(`SELECT COUNT(*) FROM passwords`).Scan(&logins); err != nil {
+		t.Fatalf("counting the logins of the backup failed: %s", err)
+	}
+	if logins != len(fixtureLogins) {
+		t.Errorf("backup holds %d logins, expected %d", logins, len(fixtureLogins))
+	}
+	if err := backup.QueryRow(`SELECT COUNT(*) FROM schema_version`).Scan(&versions); err != nil {
+		t.Fatalf("reading the schema version of the backup failed: %s", err)
+	}
+	if versions != 0 {
+		t.Errorf("backup has %d migrations recorded, expected none", versions)
+	}
+}
+
+func TestNewDatabaseIsNotBackedUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kittypass.db")
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	s.Close()
+
+	backups, err := filepath.Glob(path + ".*.bak")
+	if err != nil {
+		t.Fatalf("listing backups failed: %s", err)
+	}
+	if len(backups) != 0 {
+		t.Fatalf("found backups %v of a new database, expected none", backups)
+	}
+}
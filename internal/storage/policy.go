@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// SavePolicy stores a named password policy. Policies are shared by every vault and hold no secret.
+func (s *Storage) SavePolicy(name, options string) (int64, error) {
+	result, err := s.db.Exec(`INSERT INTO policies (name, options) VALUES (?, ?)`, name, options)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey) {
+			return 0, StorageConstraintError{Field: "name", Type: "Policy"}
+		}
+		log.Printf("failed to save policy %s. err: %s", name, err)
+		return 0, StorageUpdateError{}
+	}
+	return result.LastInsertId()
+}
+
+func (s *Storage) GetPolicy(name string) (map[string]string, error) {
+	var options, dateCreated string
+	err := s.db.QueryRow(`SELECT options, date_created FROM policies WHERE name = ?`, name).Scan(&options, &dateCreated)
+	if err != nil {
+		log.Printf("failed to read policy %s: %s", name, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, PolicyNotFound{Name: name}
+		}
+		return nil, StorageReadError{}
+	}
+	return map[string]string{"name": name, "options": options, "date_created": dateCreated}, nil
+}
+
+func (s *Storage) ListPolicy() ([]map[string]string, error) {
+	rows, err := s.db.Query(`SELECT name, options, date_created FROM policies ORDER BY name`)
+	if err != nil {
+		log.Printf("failed to query database for policies. err: %s", err)
+		return nil, StorageReadError{}
+	}
+	defer rows.Close()
+
+	var policyList []map[string]string
+	for rows.Next() {
+		var name, options, dateCreated string
+		if err := rows.Scan(&name, &options, &dateCreated); err != nil {
+			log.Printf("error while scanning results of query. err: %s", err)
+			return nil, StorageReadError{}
+		}
+		policyList = append(policyList, map[string]string{"name": name, "options": options, "date_created": dateCreated})
+	}
+	return policyList, nil
+}
+
+// DeletePolicy deletes a password policy. A policy still used by logins is not deleted.
+func (s *Storage) DeletePolicy(name string) error {
+	var logins int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM passwords WHERE policy = ?`, name).Scan(&logins); err != nil {
+		log.Printf("failed to count logins using policy %s. err: %s", name, err)
+		return StorageReadError{}
+	}
+	if logins > 0 {
+		return PolicyInUseError{Name: name, Logins: logins}
+	}
+	res, err := s.db.Exec(`DELETE FROM policies WHERE name = ?`, name)
+	if err != nil {
+		log.Printf("failed to delete policy %s. err: %s", name, err)
+		return StorageUpdateError{}
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("could not get the number of deleted policy entries: %s", err)
+		return StorageUpdateError{}
+	}
+	if affected < 1 {
+		return PolicyNotFound{Name: name}
+	}
+	return nil
+}
@@ -3,11 +3,11 @@ package storage
 import (
 	"database/sql"
 	"errors"
-	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 
-	"github.com/google/uuid"
 	sqlite3 "github.com/mattn/go-sqlite3"
 )
 
@@ -16,6 +16,14 @@ type Storage struct {
 }
 
 func New(databasePath string) (*Storage, error) {
+	if err := os.MkdirAll(filepath.Dir(databasePath), 0700); err != nil {
+		log.Printf("failed to create directory for sqlite database at path %s. err: %s", databasePath, err)
+		return nil, StorageAccessError{}
+	}
+	if err := createPrivateFile(databasePath); err != nil {
+		log.Printf("failed to restrict access to sqlite database at path %s. err: %s", databasePath, err)
+		return nil, StorageAccessError{}
+	}
 	db, err := sql.Open("sqlite3", databasePath)
 	if err != nil {
 		log.Printf("failed to open sqlite database at path %s. err: %s", databasePath, err)
@@ -24,58 +32,41 @@ func New(databasePath string) (*Storage, error) {
 
 	storage := &Storage{db: db}
 
-	if err := storage.initDB(); err != nil {
+	if err := storage.migrate(databasePath); err != nil {
 		db.Close()
-		log.Println("failed to initialize sqlite database with required tables")
-		return nil, StorageInitError{}
+		log.Println("failed to bring sqlite database up to the current schema")
+		return nil, err
 	}
 
 	return storage, nil
 }
 
-func (s *Storage) Close() {
-	s.db.Close()
-}
-
-func (s *Storage) initDB() error {
-	vaultsQuery := `CREATE TABLE IF NOT EXISTS vaults (
-        uuid TEXT PRIMARY KEY,
-        name TEXT NOT NULL UNIQUE,
-		description TEXT NOT NULL,
-        hex_hashed_master_password TEXT NOT NULL,
-		hex_salt TEXT NOT NULL,
-        date_created DATETIME DEFAULT CURRENT_TIMESTAMP
-    );`
-	_, err := s.db.Exec(vaultsQuery)
-	if err != nil {
-		log.Printf("error when running create query for vaults table: %s", err)
-		return err
+// createPrivateFile creates the file at path readable and writable by its owner only, or restricts an existing file the same way,
+// before SQLite writes anything to it.
+func createPrivateFile(path string) error {
+	if path == ":memory:" {
+		return nil
 	}
-
-	passwordsQuery := `CREATE TABLE IF NOT EXISTS passwords ( 
-		identifier TEXT NOT NULL UNIQUE,
-        vault_uuid TEXT NOT NULL,
-        name TEXT NOT NULL,
-        username TEXT NOT NULL,
-        hex_encrypted_password TEXT NOT NULL,
-        date_created DATETIME DEFAULT CURRENT_TIMESTAMP,
-        FOREIGN KEY(vault_uuid) REFERENCES vaults(uuid)
-    );`
-	_, err = s.db.Exec(passwordsQuery)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
 	if err != nil {
-		log.Printf("error when running create query for passwords table: %s", err)
 		return err
 	}
-	return nil
+	defer f.Close()
+	return f.Chmod(0600)
 }
 
-func (s *Storage) SaveVault(name, description, hexHashedMaster, hexSalt string) (int64, error) {
-	uuid, err := uuid.NewV7()
-	if err != nil {
-		return 0, fmt.Errorf("error while generating an uuid for the vault: %s", err)
-	}
-	query := `INSERT INTO vaults (uuid, name, description, hex_hashed_master_password, hex_salt) VALUES (?, ?, ?, ?, ?)`
-	result, err := s.db.Exec(query, uuid, name, description, hexHashedMaster, hexSalt)
+func (s *Storage) Close() {
+	s.db.Close()
+}
+
+// LoginIdentifier returns the identifier of the login named name in the vault, unique across all vaults.
+func LoginIdentifier(vaultUuid, name string) string {
+	return vaultUuid + "_" + name
+}
+
+func (s *Storage) SaveVault(uuid, name, description, cipher, hexKeyCheck, hexSalt, hexWrappedKey string, kdfTime, kdfMemory uint32, kdfThreads uint8) (int64, error) {
+	query := `INSERT INTO vaults (uuid, name, description, cipher, hex_key_check, hex_salt, hex_wrapped_key, kdf_time, kdf_memory, kdf_threads) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := s.db.Exec(query, uuid, name, description, cipher, hexKeyCheck, hexSalt, hexWrappedKey, kdfTime, kdfMemory, kdfThreads)
 	if err != nil {
 		if sqliteErr, ok := err.(sqlite3.Error); ok {
 			if sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
@@ -88,12 +79,14 @@ func (s *Storage) SaveVault(name, description, hexHashedMaster, hexSalt string)
 	return result.LastInsertId()
 }
 
+// GetVault returns the vault named name. hex_hashed_master_password is only set for vaults created before key check values
+// existed and not unlocked since.
 func (s *Storage) GetVault(name string) (map[string]string, error) {
-	query := `SELECT uuid, description, hex_hashed_master_password, hex_salt
-	 FROM vaults WHERE name = ?`
+	query := `SELECT v.uuid, v.description, v.cipher, v.hex_key_check, COALESCE(l.hex_hashed_master_password, ''), v.hex_salt, v.hex_wrapped_key, v.kdf_time, v.kdf_memory, v.kdf_threads, v.min_envelope_version
+	 FROM vaults v LEFT JOIN legacy_verifiers l ON l.vault_uuid = v.uuid WHERE v.name = ?`
 	row := s.db.QueryRow(query, name)
-	var uuid, description, hex_hashed_master_password, hex_salt string
-	err := row.Scan(&uuid, &description, &hex_hashed_master_password, &hex_salt)
+	var uuid, description, cipher, hex_key_check, hex_hashed_master_password, hex_salt, hex_wrapped_key, kdf_time, kdf_memory, kdf_threads, min_envelope_version string
+	err := row.Scan(&uuid, &description, &cipher, &hex_key_check, &hex_hashed_master_password, &hex_salt, &hex_wrapped_key, &kdf_time, &kdf_memory, &kdf_threads, &min_envelope_version)
 	if err != nil {
 		log.Printf("failed to read entry from database: %s", err)
 		if errors.Is(sql.ErrNoRows, err) {
@@ -104,8 +97,15 @@ func (s *Storage) GetVault(name string) (map[string]string, error) {
 	return map[string]string{
 		"uuid":                       uuid,
 		"description":                description,
+		"cipher":                     cipher,
+		"hex_key_check":              hex_key_check,
 		"hex_hashed_master_password": hex_hashed_master_password,
 		"hex_salt":                   hex_salt,
+		"hex_wrapped_key":            hex_wrapped_key,
+		"kdf_time":                   kdf_time,
+		"kdf_memory":                 kdf_memory,
+		"kdf_threads":                kdf_threads,
+		"min_envelope_version":       min_envelope_version,
 	}, nil
 }
 
@@ -139,8 +139,9 @@ func (s *Storage) ListVault(name string) ([]map[string]string, error) {
 	return vaultList, nil
 }
 
-func (s *Storage) UpdateVault(vaultUuid, newName, newDescription, newMasterPassHashedHex, newSalt string, loginList []map[string]string) (map[string]int, error) {
-	affectedLogin := 0
+// UpdateVault changes the name and description of the vault, ignoring empty values.
+// When newSalt is not empty, the key check value, wrapped data key and key derivation parameters are replaced as well.
+func (s *Storage) UpdateVault(vaultUuid, newName, newDescription, newKeyCheck, newSalt, newWrappedKey string, kdfTime, kdfMemory uint32, kdfThreads uint8) (map[string]int, error) {
 	affectedVault := 0
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -153,28 +154,6 @@ func (s *Storage) UpdateVault(vaultUuid, newName, newDescription, newMasterPassH
 			tx.Rollback()
 		}
 	}()
-	if len(loginList) > 0 {
-		loginQuery := `UPDATE passwords SET hex_encrypted_password = ? WHERE name = ? AND vault_uuid = ?`
-		for _, login := range loginList {
-			res, err := tx.Exec(loginQuery, login["newHexEncrypted"], login["name"], vaultUuid)
-			if err != nil {
-				log.Printf("failed to update passwords associated with the vault: %s", err)
-				return nil, StorageUpdateError{}
-			}
-
-			aff, err := res.RowsAffected()
-			if err != nil {
-				log.Printf("could not get the number of updated password entries: %s", err)
-				return nil, StorageUpdateError{}
-			}
-			affectedLogin += int(aff)
-		}
-
-		if affectedLogin != len(loginList) {
-			log.Printf("failed to update all logins password. %d updated logins for %d login. Aborting update", affectedLogin, len(loginList))
-			return nil, StorageUpdateError{}
-		}
-	}
 
 	var args []interface{}
 	vaultQuery := `UPDATE vaults SET`
@@ -188,11 +167,15 @@ func (s *Storage) UpdateVault(vaultUuid, newName, newDescription, newMasterPassH
 		setClause = append(setClause, " description = ?")
 		args = append(args, newDescription)
 	}
-	if len(loginList) > 0 {
+	if newSalt != "" {
 		setClause = append(setClause, " hex_salt = ?")
 		args = append(args, newSalt)
-		setClause = append(setClause, " hex_hashed_master_password = ?")
-		args = append(args, newMasterPassHashedHex)
+		setClause = append(setClause, " hex_key_check = ?")
+		args = append(args, newKeyCheck)
+		setClause = append(setClause, " hex_wrapped_key = ?")
+		args = append(args, newWrappedKey)
+		setClause = append(setClause, " kdf_time = ?", " kdf_memory = ?", " kdf_threads = ?")
+		args = append(args, kdfTime, kdfMemory, kdfThreads)
 	}
 	vaultQuery += strings.Join(setClause, ",")
 	vaultQuery += whereClause
@@ -214,15 +197,121 @@ func (s *Storage) UpdateVault(vaultUuid, newName, newDescription, newMasterPassH
 		log.Println("failed to update vault.")
 		return nil, StorageUpdateError{}
 	}
+	if newSalt != "" {
+		if err = deleteLegacyVerifier(tx, vaultUuid); err != nil {
+			return nil, err
+		}
+	}
 	if err = tx.Commit(); err != nil {
 		log.Printf("failed to commit transaction: %s", err)
 		return nil, StorageUpdateError{}
 	}
-	return map[string]int{"updated_login": affectedLogin, "updated_vault": affectedVault}, nil
+	return map[string]int{"updated_vault": affectedVault}, nil
+}
+
+// SaveKeyCheck sets the key check value of a vault created before key check values existed, and deletes its bcrypt master password hash.
+func (s *Storage) SaveKeyCheck(vaultUuid, hexKeyCheck string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("failed to begin transaction: %s", err)
+		return StorageUpdateError{}
+	}
+	if _, err = tx.Exec(`UPDATE vaults SET hex_key_check = ? WHERE uuid = ?`, hexKeyCheck, vaultUuid); err != nil {
+		log.Printf("failed to save the key check value of vault %s, rolling back. err: %s", vaultUuid, err)
+		tx.Rollback()
+		return StorageUpdateError{}
+	}
+	if err = deleteLegacyVerifier(tx, vaultUuid); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		log.Printf("failed to commit transaction: %s", err)
+		return StorageUpdateError{}
+	}
+	return nil
+}
+
+// RaiseMinEnvelopeVersion saves the key check value and wrapped data key of a vault, and raises the oldest ciphertext
+// envelope version the vault accepts to version. The minimum version is never lowered.
+func (s *Storage) RaiseMinEnvelopeVersion(vaultUuid, hexKeyCheck, hexWrappedKey string, version int) error {
+	query := `UPDATE vaults SET hex_key_check = ?, hex_wrapped_key = ?, min_envelope_version = MAX(min_envelope_version, ?) WHERE uuid = ?`
+	if _, err := s.db.Exec(query, hexKeyCheck, hexWrappedKey, version, vaultUuid); err != nil {
+		log.Printf("failed to raise the minimum envelope version of vault %s. err: %s", vaultUuid, err)
+		return StorageUpdateError{}
+	}
+	return nil
+}
+
+func deleteLegacyVerifier(tx *sql.Tx, vaultUuid string) error {
+	if _, err := tx.Exec(`DELETE FROM legacy_verifiers WHERE vault_uuid = ?`, vaultUuid); err != nil {
+		log.Printf("failed to delete the master password hash of vault %s. err: %s", vaultUuid, err)
+		return StorageUpdateError{}
+	}
+	return nil
+}
+
+// ReencryptLogins saves the new encrypted password and salt of every login in the list, in a single transaction.
+func (s *Storage) ReencryptLogins(vaultUuid string, loginList []map[string]string) (int, error) {
+	return s.RotateVaultKey(vaultUuid, "", "", loginList)
+}
+
+// RotateVaultKey saves the new encrypted password and salt of every login in the list along with the new cipher and wrapped data key of the vault, in a single transaction.
+// The cipher and wrapped key of the vault are left untouched when newWrappedKey is empty.
+func (s *Storage) RotateVaultKey(vaultUuid, cipher, newWrappedKey string, loginList []map[string]string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("failed to begin transaction: %s", err)
+		return 0, StorageUpdateError{}
+	}
+	affected, err := updateLoginCiphers(tx, vaultUuid, loginList)
+	if err != nil {
+		log.Printf("rolling back update because an error happened. err: %s", err)
+		tx.Rollback()
+		return 0, err
+	}
+	if newWrappedKey != "" {
+		if _, err = tx.Exec(`UPDATE vaults SET cipher = ?, hex_wrapped_key = ? WHERE uuid = ?`, cipher, newWrappedKey, vaultUuid); err != nil {
+			log.Printf("failed to update the wrapped key of vault %s, rolling back. err: %s", vaultUuid, err)
+			tx.Rollback()
+			return 0, StorageUpdateError{}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		log.Printf("failed to commit transaction: %s", err)
+		return 0, StorageUpdateError{}
+	}
+	return affected, nil
+}
+
+// updateLoginCiphers sets the newHexEncrypted password and newHexSalt of every login in the list. It fails unless every login is updated.
+func updateLoginCiphers(tx *sql.Tx, vaultUuid string, loginList []map[string]string) (int, error) {
+	affectedLogin := 0
+	loginQuery := `UPDATE passwords SET hex_encrypted_password = ?, hex_salt = ? WHERE name = ? AND vault_uuid = ?`
+	for _, login := range loginList {
+		res, err := tx.Exec(loginQuery, login["newHexEncrypted"], login["newHexSalt"], login["name"], vaultUuid)
+		if err != nil {
+			log.Printf("failed to update passwords associated with the vault: %s", err)
+			return 0, StorageUpdateError{}
+		}
+
+		aff, err := res.RowsAffected()
+		if err != nil {
+			log.Printf("could not get the number of updated password entries: %s", err)
+			return 0, StorageUpdateError{}
+		}
+		affectedLogin += int(aff)
+	}
+
+	if affectedLogin != len(loginList) {
+		log.Printf("failed to update all logins password. %d updated logins for %d login. Aborting update", affectedLogin, len(loginList))
+		return 0, StorageUpdateError{}
+	}
+	return affectedLogin, nil
 }
 
 func (s *Storage) ReadLogins(vault_uuid string) ([]map[string]string, error) {
-	query := `SELECT identifier, name, username, hex_encrypted_password FROM passwords WHERE vault_uuid = ?`
+	query := `SELECT identifier, name, username, hex_encrypted_password, hex_salt, date_created, date_password_changed FROM passwords WHERE vault_uuid = ?`
 	rows, err := s.db.Query(query, vault_uuid)
 	if err != nil {
 		log.Printf("failed to query database for logins associated with vauld uuid %s. err: %s", vault_uuid, err)
@@ -232,13 +321,17 @@ func (s *Storage) ReadLogins(vault_uuid string) ([]map[string]string, error) {
 
 	var loginList []map[string]string
 	for rows.Next() {
-		var identifier, name, username, hex_encrypted_password string
-		err := rows.Scan(&identifier, &name, &username, &hex_encrypted_password)
+		var identifier, name, username, hex_encrypted_password, hex_salt, date_created string
+		var date_password_changed sql.NullString
+		err := rows.Scan(&identifier, &name, &username, &hex_encrypted_password, &hex_salt, &date_created, &date_password_changed)
 		if err != nil {
 			log.Printf("error while scanning results of query. err: %s", err)
 			return nil, StorageReadError{}
 		}
-		loginList = append(loginList, map[string]string{"identifier": identifier, "name": name, "username": username, "hex_enc_pass": hex_encrypted_password})
+		if !date_password_changed.Valid {
+			date_password_changed.String = date_created
+		}
+		loginList = append(loginList, map[string]string{"identifier": identifier, "name": name, "username": username, "hex_enc_pass": hex_encrypted_password, "hex_salt": hex_salt, "date_password_changed": date_password_changed.String})
 	}
 	return loginList, nil
 }
@@ -275,6 +368,10 @@ func (s *Storage) DeleteVault(name, vault_uuid string) (map[string]int64, error)
 		return nil, StorageUpdateError{}
 	}
 
+	if err = deleteLegacyVerifier(tx, vault_uuid); err != nil {
+		return nil, err
+	}
+
 	vaultQuery := `DELETE FROM vaults WHERE name = ? AND uuid = ?`
 	res, err = tx.Exec(vaultQuery, name, vault_uuid)
 	if err != nil {
@@ -298,10 +395,10 @@ func (s *Storage) DeleteVault(name, vault_uuid string) (map[string]int64, error)
 	return map[string]int64{"delete_login": affectedLogin, "delete_vault": affectedVault}, nil
 }
 
-func (s *Storage) SaveLogin(vaultUuid, name, username, hexEncryptedPassword string) (int64, error) {
-	identifier := vaultUuid + "_" + name
-	query := `INSERT INTO passwords (vault_uuid, identifier, name, username, hex_encrypted_password) VALUES (?, ?, ?, ?, ?)`
-	result, err := s.db.Exec(query, vaultUuid, identifier, name, username, hexEncryptedPassword)
+func (s *Storage) SaveLogin(vaultUuid, name, username, hexEncryptedPassword, hexSalt, policy string) (int64, error) {
+	identifier := LoginIdentifier(vaultUuid, name)
+	query := `INSERT INTO passwords (vault_uuid, identifier, name, username, hex_encrypted_password, hex_salt, policy, date_password_changed) VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+	result, err := s.db.Exec(query, vaultUuid, identifier, name, username, hexEncryptedPassword, hexSalt, policy)
 	if err != nil {
 		log.Printf("failed to add new login %s to vault %s. err: %s", name, vaultUuid, err)
 		return 0, StorageUpdateError{}
@@ -309,21 +406,61 @@ func (s *Storage) SaveLogin(vaultUuid, name, username, hexEncryptedPassword stri
 	return result.LastInsertId()
 }
 
+// SaveLogins adds every login of the list to a vault in a single transaction: either all of them are saved or none is.
+// Each login holds a name, username, hexEncryptedPassword and hexSalt.
+func (s *Storage) SaveLogins(vaultUuid string, loginList []map[string]string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("failed to begin transaction: %s", err)
+		return 0, StorageUpdateError{}
+	}
+	defer func() {
+		if err != nil {
+			log.Printf("rolling back the addition of logins because an error happened. err: %s", err)
+			tx.Rollback()
+		}
+	}()
+
+	query := `INSERT INTO passwords (vault_uuid, identifier, name, username, hex_encrypted_password, hex_salt, date_password_changed) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+	for _, login := range loginList {
+		identifier := LoginIdentifier(vaultUuid, login["name"])
+		if _, err = tx.Exec(query, vaultUuid, identifier, login["name"], login["username"], login["hexEncryptedPassword"], login["hexSalt"]); err != nil {
+			var sqliteErr sqlite3.Error
+			if errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey) {
+				return 0, StorageConstraintError{Field: "name", Type: "Login"}
+			}
+			return 0, StorageUpdateError{}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("failed to commit transaction: %s", err)
+		return 0, StorageUpdateError{}
+	}
+	return len(loginList), nil
+}
+
 func (s *Storage) ReadLogin(vault_uuid, name string) (map[string]string, error) {
-	query := `SELECT username, hex_encrypted_password FROM passwords WHERE name = ? AND vault_uuid = ?`
+	query := `SELECT identifier, username, hex_encrypted_password, hex_salt, policy FROM passwords WHERE name = ? AND vault_uuid = ?`
 	row := s.db.QueryRow(query, name, vault_uuid)
 
-	var username, hexEncryptedPassword string
-	err := row.Scan(&username, &hexEncryptedPassword)
+	var identifier, username, hexEncryptedPassword, hexSalt, policy string
+	err := row.Scan(&identifier, &username, &hexEncryptedPassword, &hexSalt, &policy)
 	if err != nil {
 		log.Printf("error while scanning results of query. err: %s", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, LoginNotFound{}
+		}
 		return nil, StorageReadError{}
 	}
 
 	return map[string]string{
+		"identifier":             identifier,
 		"name":                   name,
 		"username":               username,
 		"hex_encrypted_password": hexEncryptedPassword,
+		"hex_salt":               hexSalt,
+		"policy":                 policy,
 	}, nil
 }
 
@@ -378,7 +515,9 @@ func (s *Storage) ListLogin(vault_uuid, name, username string) ([]map[string]str
 	return loginList, nil
 }
 
-func (s *Storage) UpdateLogin(vaultUuid, target, name, username, hexEncryptedPassword string) (int64, error) {
+// UpdateLogin changes the name, username, encrypted password or policy of the login named target, ignoring empty values.
+// passwordChanged records a new password, rather than the same password encrypted again.
+func (s *Storage) UpdateLogin(vaultUuid, target, name, username, hexEncryptedPassword, hexSalt, policy string, passwordChanged bool) (int64, error) {
 	var args []interface{}
 	query := `UPDATE passwords SET`
 	whereClause := " WHERE name = ? AND vault_uuid = ?"
@@ -387,7 +526,7 @@ func (s *Storage) UpdateLogin(vaultUuid, target, name, username, hexEncryptedPas
 		setClause = append(setClause, " name = ?")
 		args = append(args, name)
 		setClause = append(setClause, " identifier = ?")
-		args = append(args, vaultUuid+"_"+name)
+		args = append(args, LoginIdentifier(vaultUuid, name))
 	}
 	if username != "" {
 		setClause = append(setClause, " username = ?")
@@ -396,6 +535,15 @@ func (s *Storage) UpdateLogin(vaultUuid, target, name, username, hexEncryptedPas
 	if hexEncryptedPassword != "" {
 		setClause = append(setClause, " hex_encrypted_password = ?")
 		args = append(args, hexEncryptedPassword)
+		setClause = append(setClause, " hex_salt = ?")
+		args = append(args, hexSalt)
+	}
+	if passwordChanged {
+		setClause = append(setClause, " date_password_changed = CURRENT_TIMESTAMP")
+	}
+	if policy != "" {
+		setClause = append(setClause, " policy = ?")
+		args = append(args, policy)
 	}
 	query += strings.Join(setClause, ",")
 	query += whereClause
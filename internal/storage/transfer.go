@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// ExportVault returns every column of the vault row and of the passwords rows associated with it, as stored.
+// Encrypted values are returned untouched so that they can be imported in another backend without decryption.
+// The bcrypt master password hash of a vault not yet unlocked since key check values exist is returned as hex_hashed_master_password.
+func (s *Storage) ExportVault(name string) (map[string]string, []map[string]string, error) {
+	vaultRows, err := s.db.Query(`SELECT * FROM vaults WHERE name = ?`, name)
+	if err != nil {
+		log.Printf("failed to query database for vault %s. err: %s", name, err)
+		return nil, nil, StorageReadError{}
+	}
+	vaultList, err := scanRows(vaultRows)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(vaultList) != 1 {
+		log.Printf("vault %s does not exist", name)
+		return nil, nil, VaultNotFound{}
+	}
+	vault := vaultList[0]
+
+	var legacyHash string
+	err = s.db.QueryRow(`SELECT hex_hashed_master_password FROM legacy_verifiers WHERE vault_uuid = ?`, vault["uuid"]).Scan(&legacyHash)
+	switch {
+	case err == nil:
+		vault["hex_hashed_master_password"] = legacyHash
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Printf("failed to query database for the master password hash of vault %s. err: %s", name, err)
+		return nil, nil, StorageReadError{}
+	}
+
+	loginRows, err := s.db.Query(`SELECT * FROM passwords WHERE vault_uuid = ? ORDER BY identifier`, vault["uuid"])
+	if err != nil {
+		log.Printf("failed to query database for logins associated with vault uuid %s. err: %s", vault["uuid"], err)
+		return nil, nil, StorageReadError{}
+	}
+	loginList, err := scanRows(loginRows)
+	if err != nil {
+		return nil, nil, err
+	}
+	return vault, loginList, nil
+}
+
+// ImportVault inserts a vault row and its passwords rows as returned by ExportVault, in a single transaction.
+func (s *Storage) ImportVault(vault map[string]string, loginList []map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("failed to begin transaction: %s", err)
+		return StorageUpdateError{}
+	}
+	defer func() {
+		if err != nil {
+			log.Printf("rolling back import because an error happened. err: %s", err)
+			tx.Rollback()
+		}
+	}()
+
+	vaultRow := make(map[string]string, len(vault))
+	for column, value := range vault {
+		vaultRow[column] = value
+	}
+	legacyHash, isLegacy := vaultRow["hex_hashed_master_password"]
+	delete(vaultRow, "hex_hashed_master_password")
+
+	if err = insertRow(tx, "vaults", vaultRow); err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey) {
+			return StorageConstraintError{Field: "name or uuid", Type: "Vault"}
+		}
+		return StorageUpdateError{}
+	}
+	if isLegacy && legacyHash != "" {
+		if err = insertRow(tx, "legacy_verifiers", map[string]string{"vault_uuid": vaultRow["uuid"], "hex_hashed_master_password": legacyHash}); err != nil {
+			return StorageUpdateError{}
+		}
+	}
+	for _, login := range loginList {
+		if err = insertRow(tx, "passwords", login); err != nil {
+			return StorageUpdateError{}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("failed to commit transaction: %s", err)
+		return StorageUpdateError{}
+	}
+	return nil
+}
+
+// scanRows reads every row into a map of column name to value. NULL values are left out of the map.
+func scanRows(rows *sql.Rows) ([]map[string]string, error) {
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		log.Printf("failed to read columns of query results. err: %s", err)
+		return nil, StorageReadError{}
+	}
+
+	var result []map[string]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			log.Printf("error while scanning results of query. err: %s", err)
+			return nil, StorageReadError{}
+		}
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			if values[i].Valid {
+				row[column] = values[i].String
+			}
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over results of query. err: %s", err)
+		return nil, StorageReadError{}
+	}
+	return result, nil
+}
+
+func insertRow(tx *sql.Tx, table string, row map[string]string) error {
+	var columns, placeholders []string
+	var args []interface{}
+	for column, value := range row {
+		if strings.ContainsAny(column, "\"\x00") {
+			log.Printf("refusing to insert into %s with invalid column name %q", table, column)
+			return StorageUpdateError{}
+		}
+		columns = append(columns, `"`+column+`"`)
+		placeholders = append(placeholders, "?")
+		args = append(args, value)
+	}
+	query := `INSERT INTO ` + table + ` (` + strings.Join(columns, ", ") + `) VALUES (` + strings.Join(placeholders, ", ") + `)`
+	if _, err := tx.Exec(query, args...); err != nil {
+		log.Printf("failed to insert row into %s. err: %s", table, err)
+		return err
+	}
+	return nil
+}
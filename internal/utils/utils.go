@@ -55,3 +55,24 @@ func AddToClipboard(text string) error {
 
 	return nil
 }
+
+// ReadClipboard returns the text held by the clipboard.
+func ReadClipboard() (string, error) {
+	if IsWSL() {
+		// clip.exe can only write, the clipboard is read through PowerShell
+		out, err := exec.Command("powershell.exe", "-NoProfile", "-Command", "Get-Clipboard -Raw").Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to read clipboard using powershell.exe: %v", err)
+		}
+		return strings.TrimSuffix(string(out), "\r\n"), nil
+	}
+	if err := clipboard.Init(); err != nil {
+		return "", fmt.Errorf("failed to initialize clipboard: %v", err)
+	}
+	return string(clipboard.Read(clipboard.FmtText)), nil
+}
+
+// ClearClipboard empties the clipboard.
+func ClearClipboard() error {
+	return AddToClipboard("")
+}
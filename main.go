@@ -1,7 +1,7 @@
 package main
 
 import (
-	"log"
+	"errors"
 	"os"
 
 	cc "github.com/ivanpirog/coloredcobra"
@@ -9,18 +9,6 @@ import (
 )
 
 func main() {
-	homedir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatal(err)
-	}
-	
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-	file, err := os.OpenFile(homedir+"/.kittypass.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-    if err != nil {
-        log.Fatal(err)
-    }
-    log.SetOutput(file)
-
 	cmd := root.NewRootCmd()
 	cc.Init(&cc.Config{
 		RootCmd:  cmd,
@@ -31,6 +19,11 @@ func main() {
 		Flags:    cc.Bold,
 	})
 	if err := cmd.Execute(); err != nil {
+		var exit root.ExitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.Code)
+		}
+		root.PrintError(err)
 		os.Exit(1)
 	}
 }